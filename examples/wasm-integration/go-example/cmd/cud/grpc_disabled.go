@@ -0,0 +1,18 @@
+//go:build !grpc
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/twilson63/cu/examples/wasm-integration/go-example/pkg/luaserver"
+)
+
+// serveGRPC is the default (non-grpc-tagged) build's stand-in: this binary
+// was built without -tags grpc, so pkg/luaserver/luaserverpb (generated
+// from luaserver.proto) isn't compiled in. Build with -tags grpc after
+// `go generate ./pkg/luaserver` to enable it.
+func serveGRPC(_ *luaserver.Server, _ string) error {
+	fmt.Println("cud: gRPC support not compiled in (build with -tags grpc)")
+	return nil
+}
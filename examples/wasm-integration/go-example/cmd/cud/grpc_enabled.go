@@ -0,0 +1,26 @@
+//go:build grpc
+
+package main
+
+import (
+	"fmt"
+	"net"
+
+	"google.golang.org/grpc"
+
+	"github.com/twilson63/cu/examples/wasm-integration/go-example/pkg/luaserver"
+)
+
+// serveGRPC starts the gRPC EvalService on addr and blocks serving it. Only
+// built with -tags grpc, once pkg/luaserver/luaserverpb has been generated
+// via `go generate ./pkg/luaserver` (see pkg/luaserver/grpc.go).
+func serveGRPC(srv *luaserver.Server, addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("listen %s: %w", addr, err)
+	}
+	gs := grpc.NewServer()
+	srv.RegisterGRPC(gs)
+	fmt.Printf("cud: gRPC listening on %s\n", addr)
+	return gs.Serve(lis)
+}
@@ -0,0 +1,102 @@
+// Command cud runs the Lua compute runtime as a network daemon: an HTTP API
+// for eval and external-table management. A gRPC counterpart exists as an
+// unfinished follow-up (build with -tags grpc; see grpc_enabled.go) and
+// isn't exercised by anything in this tree yet — HTTP is the supported way
+// to reach it today.
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/twilson63/cu/examples/wasm-integration/go-example/pkg/luametrics"
+	"github.com/twilson63/cu/examples/wasm-integration/go-example/pkg/luapool"
+	"github.com/twilson63/cu/examples/wasm-integration/go-example/pkg/luaserver"
+	"github.com/twilson63/cu/examples/wasm-integration/go-example/pkg/luastore"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "cud: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	ctx := context.Background()
+
+	wasmPath := os.Getenv("CU_WASM_PATH")
+	if wasmPath == "" {
+		wasmPath = "../../../web/lua.wasm"
+	}
+	wasmBytes, err := os.ReadFile(wasmPath)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", wasmPath, err)
+	}
+
+	storage, err := newStorageFromEnv()
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	// Metrics and tracing are opt-in (set CU_ENABLE_METRICS=1), the same
+	// switch the one-shot main.go example uses, and cost nothing when left
+	// off: luapool.Config and luaserver.Server both accept a nil
+	// *luametrics.Metrics.
+	var metrics *luametrics.Metrics
+	if os.Getenv("CU_ENABLE_METRICS") != "" {
+		metrics = luametrics.New()
+	}
+
+	poolSize := 8
+	pool, err := luapool.New(ctx, wasmBytes, luapool.Config{Size: poolSize, Storage: storage, Metrics: metrics})
+	if err != nil {
+		return fmt.Errorf("build lua pool: %w", err)
+	}
+	defer pool.Close(ctx)
+
+	srv := luaserver.New(pool, storage)
+	srv.Metrics = metrics
+
+	grpcAddr := envOr("CU_GRPC_ADDR", ":9091")
+	go func() {
+		if err := serveGRPC(srv, grpcAddr); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}()
+
+	httpAddr := envOr("CU_HTTP_ADDR", ":8080")
+	fmt.Printf("cud: HTTP listening on %s\n", httpAddr)
+	// A daemon fronting untrusted tenants needs transport-level limits too,
+	// not just compute's fuel/memory/deadline: ReadHeaderTimeout and
+	// ReadTimeout bound a slow-client request, and WriteTimeout bounds the
+	// whole request including handler execution, so it has to clear the
+	// longest /eval is ever allowed to run (Limits.MaxDeadline) plus room
+	// to wait for a free pool slot.
+	httpServer := &http.Server{
+		Addr:              httpAddr,
+		Handler:           srv.Mux(),
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       10 * time.Second,
+		WriteTimeout:      luaserver.DefaultLimitPolicy.MaxDeadline + 30*time.Second,
+	}
+	return httpServer.ListenAndServe()
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func newStorageFromEnv() (luastore.Storage, error) {
+	if path := os.Getenv("CU_BOLT_PATH"); path != "" {
+		return luastore.NewBoltStorage(path)
+	}
+	return luastore.NewMemoryStorage(), nil
+}
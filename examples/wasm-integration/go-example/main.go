@@ -3,8 +3,8 @@
 // This example demonstrates:
 // - Loading lua.wasm with wazero (pure Go, no CGo)
 // - Implementing all 5 host functions in Go
-// - External table storage using Go maps
-// - Executing Lua code and handling results
+// - External table storage with a pluggable Storage backend (in-memory or BoltDB)
+// - Executing Lua code and decoding results with pkg/luaval
 // - Idiomatic Go error handling
 
 package main
@@ -13,40 +13,58 @@ import (
 	"context"
 	"encoding/binary"
 	"fmt"
-	"math"
+	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/tetratelabs/wazero"
 	"github.com/tetratelabs/wazero/api"
 	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+
+	"github.com/twilson63/cu/examples/wasm-integration/go-example/pkg/luametrics"
+	"github.com/twilson63/cu/examples/wasm-integration/go-example/pkg/luastore"
+	"github.com/twilson63/cu/examples/wasm-integration/go-example/pkg/luaval"
 )
 
-// ExternalTables stores all external tables
+// ExternalTables fronts a pluggable luastore.Storage backend. By default it
+// uses luastore.MemoryStorage, which vanishes at process exit; pass a
+// luastore.BoltStorage to survive restarts.
 type ExternalTables struct {
-	tables map[uint32]map[string][]byte
+	storage luastore.Storage
+	seen    map[uint32]struct{}
+	metrics *luametrics.Metrics
 }
 
-// NewExternalTables creates a new external table storage
-func NewExternalTables() *ExternalTables {
+// NewExternalTables creates external table storage backed by storage. Pass
+// luastore.NewMemoryStorage() for the original in-process-only behavior.
+// metrics may be nil, which disables instrumentation.
+func NewExternalTables(storage luastore.Storage, metrics *luametrics.Metrics) *ExternalTables {
 	return &ExternalTables{
-		tables: make(map[uint32]map[string][]byte),
+		storage: storage,
+		seen:    make(map[uint32]struct{}),
+		metrics: metrics,
 	}
 }
 
-// GetOrCreateTable returns a table by ID, creating it if necessary
-func (et *ExternalTables) GetOrCreateTable(tableID uint32) map[string][]byte {
-	if table, exists := et.tables[tableID]; exists {
-		return table
+// Sync should be called after compute returns so that a Lua invocation's
+// writes are flushed as a unit. MemoryStorage is always durable-in-process,
+// so this only matters for on-disk backends like BoltStorage.
+func (et *ExternalTables) Sync() error {
+	type syncer interface{ Sync() error }
+	if s, ok := et.storage.(syncer); ok {
+		return s.Sync()
 	}
-	table := make(map[string][]byte)
-	et.tables[tableID] = table
-	return table
+	return nil
 }
 
-// GetTable returns a table by ID, or nil if not found
-func (et *ExternalTables) GetTable(tableID uint32) map[string][]byte {
-	return et.tables[tableID]
+// TableIDs returns every tableID this process has touched, for reporting.
+func (et *ExternalTables) TableIDs() []uint32 {
+	ids := make([]uint32, 0, len(et.seen))
+	for id := range et.seen {
+		ids = append(ids, id)
+	}
+	return ids
 }
 
 func main() {
@@ -55,11 +73,31 @@ func main() {
 
 	ctx := context.Background()
 
-	// Create external table storage
-	tables := NewExternalTables()
+	// Create external table storage. Set CU_BOLT_PATH to persist tables
+	// across restarts instead of using the default in-memory backend.
+	storage, err := newStorageFromEnv()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer storage.Close()
+
+	// Metrics and tracing are opt-in (set CU_ENABLE_METRICS=1) and cost
+	// nothing when left off: NewExternalTables and friends accept a nil
+	// *luametrics.Metrics.
+	var metrics *luametrics.Metrics
+	if os.Getenv("CU_ENABLE_METRICS") != "" {
+		metrics = luametrics.New()
+		go func() {
+			http.Handle("/metrics", metrics.Handler())
+			fmt.Fprintln(os.Stderr, http.ListenAndServe(":9090", nil))
+		}()
+	}
+
+	tables := NewExternalTables(storage, metrics)
 
 	// Load and run WASM module
-	if err := runLuaWasm(ctx, tables); err != nil {
+	if err := runLuaWasm(ctx, tables, metrics); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
@@ -67,9 +105,13 @@ func main() {
 	fmt.Println("\n✓ All examples completed successfully!")
 }
 
-func runLuaWasm(ctx context.Context, tables *ExternalTables) error {
-	// Create wazero runtime
-	r := wazero.NewRuntime(ctx)
+func runLuaWasm(ctx context.Context, tables *ExternalTables, metrics *luametrics.Metrics) error {
+	// Create wazero runtime. WithCloseOnContextDone is required for ctx
+	// cancellation/timeouts to interrupt a running compute call: without
+	// it, wazero's compiler engine only checks for a closed module at WASM
+	// call-instruction boundaries, so a tight loop with no calls (e.g.
+	// "while true do end") never notices the context was canceled.
+	r := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().WithCloseOnContextDone(true))
 	defer r.Close(ctx)
 
 	// Instantiate WASI (optional, but some modules may expect it)
@@ -175,23 +217,36 @@ func runLuaWasm(ctx context.Context, tables *ExternalTables) error {
 
 	for i, ex := range examples {
 		fmt.Printf("=== Example %d: %s ===\n", i+1, ex.name)
-		if err := executeLua(ctx, compute, memory, bufferPtr, bufferSize, ex.code); err != nil {
+		if err := executeLua(ctx, compute, memory, bufferPtr, bufferSize, ex.code, metrics); err != nil {
 			return err
 		}
+		// Flush this invocation's external-table writes as a unit before
+		// moving on to the next one.
+		if err := tables.Sync(); err != nil {
+			return fmt.Errorf("sync external tables: %w", err)
+		}
 		fmt.Println()
 	}
 
 	// Show memory stats
 	fmt.Println("=== Memory Statistics ===")
-	if err := showMemoryStats(ctx, mod, bufferPtr); err != nil {
+	if err := showMemoryStats(ctx, mod, bufferPtr, metrics); err != nil {
 		return err
 	}
 
 	// Show external table contents
 	fmt.Println("\n=== External Table Contents ===")
-	for tableID, table := range tables.tables {
-		fmt.Printf("Table ID %d: %d entries\n", tableID, len(table))
-		for key, value := range table {
+	for _, tableID := range tables.TableIDs() {
+		keys, err := tables.storage.Keys(tableID)
+		if err != nil {
+			return fmt.Errorf("list keys for table %d: %w", tableID, err)
+		}
+		fmt.Printf("Table ID %d: %d entries\n", tableID, len(keys))
+		for _, key := range keys {
+			value, _, err := tables.storage.Get(tableID, key)
+			if err != nil {
+				return fmt.Errorf("read key %q for table %d: %w", key, tableID, err)
+			}
 			fmt.Printf("  '%s': %d bytes\n", key, len(value))
 		}
 	}
@@ -217,8 +272,8 @@ func loadWasmFile() ([]byte, error) {
 	return nil, fmt.Errorf("could not find lua.wasm in any of: %v", paths)
 }
 
-// executeLua executes Lua code and displays results
-func executeLua(ctx context.Context, compute api.Function, memory api.Memory, bufferPtr, bufferSize uint32, code string) error {
+// executeLua executes Lua code and displays results. metrics may be nil.
+func executeLua(ctx context.Context, compute api.Function, memory api.Memory, bufferPtr, bufferSize uint32, code string, metrics *luametrics.Metrics) error {
 	fmt.Printf("Lua code: %s\n", code)
 
 	codeBytes := []byte(code)
@@ -231,9 +286,14 @@ func executeLua(ctx context.Context, compute api.Function, memory api.Memory, bu
 		return fmt.Errorf("failed to write code to buffer")
 	}
 
+	ctx, span := metrics.StartComputeSpan(ctx)
+	defer span.End()
+
 	// Execute
+	start := time.Now()
 	results, err := compute.Call(ctx, uint64(bufferPtr), uint64(len(codeBytes)))
 	if err != nil {
+		metrics.ObserveCompute("error", time.Since(start), len(codeBytes), 0)
 		return fmt.Errorf("compute failed: %w", err)
 	}
 
@@ -245,15 +305,19 @@ func executeLua(ctx context.Context, compute api.Function, memory api.Memory, bu
 		errorLen := -resultLen - 1
 		errorBytes, ok := memory.Read(bufferPtr, uint32(errorLen))
 		if !ok {
+			metrics.ObserveCompute("error", time.Since(start), len(codeBytes), 0)
 			return fmt.Errorf("failed to read error message")
 		}
+		metrics.ObserveCompute("error", time.Since(start), len(codeBytes), len(errorBytes))
 		fmt.Printf("✗ Lua error: %s\n", string(errorBytes))
 	} else if resultLen > 0 {
 		// Success
 		resultBytes, ok := memory.Read(bufferPtr, uint32(resultLen))
 		if !ok {
+			metrics.ObserveCompute("error", time.Since(start), len(codeBytes), 0)
 			return fmt.Errorf("failed to read result")
 		}
+		metrics.ObserveCompute("ok", time.Since(start), len(codeBytes), len(resultBytes))
 
 		// First 4 bytes are output length
 		outputLen := binary.LittleEndian.Uint32(resultBytes[0:4])
@@ -264,41 +328,27 @@ func executeLua(ctx context.Context, compute api.Function, memory api.Memory, bu
 			fmt.Println()
 		}
 
-		// Parse return value (simplified)
+		// Parse the return value
 		if uint32(len(resultBytes)) > 4+outputLen {
 			returnBytes := resultBytes[4+outputLen:]
 			fmt.Printf("✓ Result: %d bytes returned\n", len(returnBytes))
 
-			// Try to parse simple types
-			if len(returnBytes) >= 2 {
-				typeTag := returnBytes[0]
-				switch typeTag {
-				case 0x03: // Number
-					if len(returnBytes) >= 9 {
-						bits := binary.LittleEndian.Uint64(returnBytes[1:9])
-						num := math.Float64frombits(bits)
-						fmt.Printf("  Number value: %v\n", num)
-					}
-				case 0x04: // String
-					if len(returnBytes) >= 5 {
-						strLen := binary.LittleEndian.Uint32(returnBytes[1:5])
-						if uint32(len(returnBytes)) >= 5+strLen {
-							str := string(returnBytes[5 : 5+strLen])
-							fmt.Printf("  String value: '%s'\n", str)
-						}
-					}
-				}
+			value, err := luaval.Decode(returnBytes)
+			if err != nil {
+				return fmt.Errorf("decode return value: %w", err)
 			}
+			fmt.Printf("  %s value: %s\n", value.Kind, value)
 		}
 	} else {
+		metrics.ObserveCompute("ok", time.Since(start), len(codeBytes), 0)
 		fmt.Println("✓ No result")
 	}
 
 	return nil
 }
 
-// showMemoryStats displays memory statistics
-func showMemoryStats(ctx context.Context, mod api.Module, bufferPtr uint32) error {
+// showMemoryStats displays memory statistics. metrics may be nil.
+func showMemoryStats(ctx context.Context, mod api.Module, bufferPtr uint32, metrics *luametrics.Metrics) error {
 	getMemoryStats := mod.ExportedFunction("get_memory_stats")
 	memory := mod.Memory()
 
@@ -318,6 +368,9 @@ func showMemoryStats(ctx context.Context, mod api.Module, bufferPtr uint32) erro
 	luaMemoryUsed := binary.LittleEndian.Uint32(statsBytes[4:8])
 	wasmPages := binary.LittleEndian.Uint32(statsBytes[8:12])
 
+	metrics.SetLuaMemoryUsed(luaMemoryUsed)
+	metrics.SetWasmPages(wasmPages)
+
 	fmt.Printf("Memory Statistics:\n")
 	fmt.Printf("  I/O Buffer Size: %d bytes (%d KB)\n", ioBufferSize, ioBufferSize/1024)
 	fmt.Printf("  Lua Memory Used: %d bytes\n", luaMemoryUsed)
@@ -346,13 +399,11 @@ func (et *ExternalTables) jsExtTableSet(ctx context.Context, m api.Module, table
 		return 1 // Error
 	}
 
-	// Make a copy of the value bytes
-	valueCopy := make([]byte, len(valBytes))
-	copy(valueCopy, valBytes)
-
-	// Store in table
-	table := et.GetOrCreateTable(tableID)
-	table[key] = valueCopy
+	if err := et.storage.Set(tableID, key, valBytes); err != nil {
+		return 1 // Error
+	}
+	et.seen[tableID] = struct{}{}
+	et.metrics.ObserveExtTableOp("set", len(valBytes))
 
 	return 0 // Success
 }
@@ -368,17 +419,11 @@ func (et *ExternalTables) jsExtTableGet(ctx context.Context, m api.Module, table
 	}
 	key := string(keyBytes)
 
-	// Get table
-	table := et.GetTable(tableID)
-	if table == nil {
-		return 0xFFFFFFFF // Not found
-	}
-
-	// Get value
-	value, exists := table[key]
-	if !exists {
+	value, exists, err := et.storage.Get(tableID, key)
+	if err != nil || !exists {
 		return 0xFFFFFFFF // Not found
 	}
+	et.metrics.ObserveExtTableOp("get", 0)
 
 	// Check buffer size
 	if uint32(len(value)) > maxLen {
@@ -404,42 +449,31 @@ func (et *ExternalTables) jsExtTableDelete(ctx context.Context, m api.Module, ta
 	}
 	key := string(keyBytes)
 
-	// Get table
-	table := et.GetTable(tableID)
-	if table == nil {
-		return 1 // Table not found
+	if err := et.storage.Delete(tableID, key); err != nil {
+		return 1 // Error
 	}
-
-	// Delete key
-	delete(table, key)
+	et.metrics.ObserveExtTableOp("delete", 0)
 
 	return 0 // Success
 }
 
 // jsExtTableSize returns the number of entries in a table
 func (et *ExternalTables) jsExtTableSize(ctx context.Context, m api.Module, tableID uint32) uint32 {
-	table := et.GetTable(tableID)
-	if table == nil {
+	size, err := et.storage.Size(tableID)
+	if err != nil {
 		return 0
 	}
-	return uint32(len(table))
+	return uint32(size)
 }
 
 // jsExtTableKeys returns all keys (newline-separated)
 func (et *ExternalTables) jsExtTableKeys(ctx context.Context, m api.Module, tableID, bufPtr, maxLen uint32) uint32 {
 	memory := m.Memory()
 
-	// Get table
-	table := et.GetTable(tableID)
-	if table == nil {
+	keys, err := et.storage.Keys(tableID)
+	if err != nil {
 		return 0xFFFFFFFF // -1 as uint32
 	}
-
-	// Serialize keys
-	var keys []string
-	for key := range table {
-		keys = append(keys, key)
-	}
 	serialized := strings.Join(keys, "\n")
 
 	if uint32(len(serialized)) > maxLen {
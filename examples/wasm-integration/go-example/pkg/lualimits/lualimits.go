@@ -0,0 +1,262 @@
+// Package lualimits adds fuel, memory, and wall-clock limits around a
+// compute invocation so untrusted Lua code can't loop forever or exhaust
+// the host.
+package lualimits
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/experimental"
+)
+
+// LimitKind identifies which limit in a Limits struct was exceeded.
+type LimitKind int
+
+const (
+	LimitFuel LimitKind = iota
+	LimitMemory
+	LimitTime
+)
+
+func (k LimitKind) String() string {
+	switch k {
+	case LimitFuel:
+		return "fuel"
+	case LimitMemory:
+		return "memory"
+	case LimitTime:
+		return "time"
+	default:
+		return "unknown"
+	}
+}
+
+// Limits bounds a single compute invocation.
+type Limits struct {
+	// Fuel caps the number of function calls the guest may make. Zero
+	// means unlimited.
+	Fuel uint64
+	// MaxMemoryPages caps the WASM linear memory, in 64KB pages. Zero
+	// means unlimited.
+	MaxMemoryPages uint32
+	// Deadline caps wall-clock time. Zero means unlimited.
+	Deadline time.Duration
+}
+
+// LimitExceededError reports which limit tripped and, where relevant, the
+// values involved.
+type LimitExceededError struct {
+	Kind   LimitKind
+	Detail string
+}
+
+func (e *LimitExceededError) Error() string {
+	return fmt.Sprintf("lualimits: %s limit exceeded: %s", e.Kind, e.Detail)
+}
+
+// LuaError reports a Lua-level error raised by the guest itself (e.g. a
+// script calling error()), as opposed to a host/Go failure. Message is the
+// text the guest wrote to its result buffer.
+type LuaError struct {
+	Message string
+}
+
+func (e *LuaError) Error() string {
+	return fmt.Sprintf("lualimits: lua error: %s", e.Message)
+}
+
+// callState is the fuel/memory bookkeeping for one in-flight
+// ExecuteWithLimits call, looked up by ListenerFactory's Before/After hooks
+// from the api.Module wazero hands them.
+type callState struct {
+	memory         api.Memory
+	fuel           *uint64 // nil if unmetered
+	maxMemoryPages uint32  // 0 if unmetered
+	memExceeded    bool
+}
+
+// ListenerFactory enforces fuel and memory limits on every function call
+// made by modules instantiated from a wazero.CompiledModule it was wired
+// into. wazero only consults a context's FunctionListenerFactory at
+// CompileModule time (it bakes the resulting listeners into the compiled
+// code), not per call, so a single ListenerFactory must be installed once
+// via OnContext before compiling and then shared by every ExecuteWithLimits
+// call against any module instantiated from that compiled code — see
+// ExecuteWithLimits.
+//
+// Because wazero hands every Before/After call the api.Module making it,
+// one ListenerFactory can still enforce independent limits per module
+// instance: ExecuteWithLimits registers this call's state under mod before
+// running, and the hooks look it up by mod rather than by closing over it.
+// states is a sync.Map rather than a plain map behind a mutex because every
+// guest function call goes through a Before/After lookup — with one
+// ListenerFactory shared pool-wide, a single mutex there would serialize
+// every slot's execution on every call, defeating the whole point of
+// LuaPool's concurrent slots.
+type ListenerFactory struct {
+	states sync.Map // api.Module -> *callState
+}
+
+// NewListenerFactory builds a ListenerFactory with no registered calls.
+func NewListenerFactory() *ListenerFactory {
+	return &ListenerFactory{}
+}
+
+// OnContext returns ctx with f installed as the FunctionListenerFactory.
+// Pass the result to wazero's CompileModule, not to a Module.Call — see
+// ListenerFactory's doc comment for why.
+func (f *ListenerFactory) OnContext(ctx context.Context) context.Context {
+	return experimental.WithFunctionListenerFactory(ctx, f)
+}
+
+func (f *ListenerFactory) register(mod api.Module, st *callState) {
+	f.states.Store(mod, st)
+}
+
+func (f *ListenerFactory) unregister(mod api.Module) {
+	f.states.Delete(mod)
+}
+
+func (f *ListenerFactory) lookup(mod api.Module) *callState {
+	st, ok := f.states.Load(mod)
+	if !ok {
+		return nil
+	}
+	return st.(*callState)
+}
+
+func (f *ListenerFactory) NewFunctionListener(api.FunctionDefinition) experimental.FunctionListener {
+	return f
+}
+
+func (f *ListenerFactory) Before(ctx context.Context, mod api.Module, _ api.FunctionDefinition, _ []uint64, _ experimental.StackIterator) {
+	st := f.lookup(mod)
+	if st == nil || st.fuel == nil || *st.fuel == 0 {
+		return
+	}
+	*st.fuel--
+	if *st.fuel == 0 {
+		mod.CloseWithExitCode(ctx, fuelExhaustedExitCode)
+	}
+}
+
+func (f *ListenerFactory) After(ctx context.Context, mod api.Module, _ api.FunctionDefinition, _ []uint64) {
+	st := f.lookup(mod)
+	if st == nil || st.maxMemoryPages == 0 {
+		return
+	}
+	if st.memory.Size()/wasmPageSize > st.maxMemoryPages {
+		st.memExceeded = true
+		mod.CloseWithExitCode(ctx, memoryExceededExitCode)
+	}
+}
+
+func (f *ListenerFactory) Abort(context.Context, api.Module, api.FunctionDefinition, error) {}
+
+// fuelExhaustedExitCode and memoryExceededExitCode are arbitrary non-zero
+// exit codes used to tell a limit-triggered CloseWithExitCode apart from
+// any other abort.
+const (
+	fuelExhaustedExitCode  = 0xF0E1
+	memoryExceededExitCode = 0xF0E2
+)
+
+// ExecuteWithLimits runs code through compute the same way the unmetered
+// example does, but enforces limits.Fuel, limits.MaxMemoryPages, and
+// limits.Deadline, returning a *LimitExceededError if any of them trip.
+// listeners must already be installed on mod's compiled module (via
+// listeners.OnContext, passed to wazero's CompileModule) for Fuel and
+// MaxMemoryPages to have any effect; it's fine to pass nil if the caller
+// only ever sets Deadline, but asking for Fuel or MaxMemoryPages without a
+// listeners is an error rather than a silent no-op, since a caller that
+// forgot to wire one up would otherwise get an unmetered run with no
+// indication the limit was never enforced.
+func ExecuteWithLimits(ctx context.Context, listeners *ListenerFactory, mod api.Module, compute api.Function, memory api.Memory, bufferPtr, bufferSize uint32, code string, limits Limits) ([]byte, error) {
+	if listeners == nil && (limits.Fuel > 0 || limits.MaxMemoryPages > 0) {
+		return nil, fmt.Errorf("lualimits: Fuel/MaxMemoryPages requested but no ListenerFactory was installed at compile time")
+	}
+
+	codeBytes := []byte(code)
+	if uint32(len(codeBytes)) > bufferSize {
+		return nil, fmt.Errorf("code too large for buffer")
+	}
+	if !memory.Write(bufferPtr, codeBytes) {
+		return nil, fmt.Errorf("failed to write code to buffer")
+	}
+
+	if limits.MaxMemoryPages > 0 && memory.Size()/wasmPageSize > limits.MaxMemoryPages {
+		return nil, &LimitExceededError{Kind: LimitMemory, Detail: fmt.Sprintf("already at %d pages, limit %d", memory.Size()/wasmPageSize, limits.MaxMemoryPages)}
+	}
+
+	if limits.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, limits.Deadline)
+		defer cancel()
+	}
+
+	var st *callState
+	if listeners != nil && (limits.Fuel > 0 || limits.MaxMemoryPages > 0) {
+		st = &callState{memory: memory, maxMemoryPages: limits.MaxMemoryPages}
+		if limits.Fuel > 0 {
+			f := limits.Fuel
+			st.fuel = &f
+		}
+		listeners.register(mod, st)
+		defer listeners.unregister(mod)
+	}
+
+	resultCh := make(chan struct {
+		results []uint64
+		err     error
+	}, 1)
+	go func() {
+		results, err := compute.Call(ctx, uint64(bufferPtr), uint64(len(codeBytes)))
+		resultCh <- struct {
+			results []uint64
+			err     error
+		}{results, err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		mod.CloseWithExitCode(ctx, 1)
+		if limits.Deadline > 0 && ctx.Err() == context.DeadlineExceeded {
+			return nil, &LimitExceededError{Kind: LimitTime, Detail: limits.Deadline.String()}
+		}
+		return nil, ctx.Err()
+	case out := <-resultCh:
+		if st != nil && st.memExceeded {
+			return nil, &LimitExceededError{Kind: LimitMemory, Detail: fmt.Sprintf("grew past %d pages during execution", limits.MaxMemoryPages)}
+		}
+		if out.err != nil {
+			if st != nil && st.fuel != nil && *st.fuel == 0 {
+				return nil, &LimitExceededError{Kind: LimitFuel, Detail: fmt.Sprintf("limit %d", limits.Fuel)}
+			}
+			return nil, fmt.Errorf("compute failed: %w", out.err)
+		}
+
+		resultLen := int32(out.results[0])
+		if resultLen < 0 {
+			errorLen := -resultLen - 1
+			errorBytes, ok := memory.Read(bufferPtr, uint32(errorLen))
+			if !ok {
+				return nil, fmt.Errorf("failed to read error message")
+			}
+			return nil, &LuaError{Message: string(errorBytes)}
+		}
+		if resultLen == 0 {
+			return nil, nil
+		}
+		resultBytes, ok := memory.Read(bufferPtr, uint32(resultLen))
+		if !ok {
+			return nil, fmt.Errorf("failed to read result")
+		}
+		return resultBytes, nil
+	}
+}
+
+const wasmPageSize = 65536
@@ -0,0 +1,180 @@
+package lualimits
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+)
+
+// recursingModule is a hand-built WASM binary exporting a 1-page memory and
+// a "compute(ptr, count) -> i32" that recurses `count` times (decrementing
+// its second parameter, the same slot ExecuteWithLimits passes
+// len(codeBytes) through as) before returning 0. Each recursive call is a
+// function entry the fuel listener's Before hook sees, so it's enough to
+// exercise real fuel exhaustion without depending on lua.wasm.
+var recursingModule = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, 0x01, 0x07, 0x01, 0x60,
+	0x02, 0x7f, 0x7f, 0x01, 0x7f, 0x03, 0x02, 0x01, 0x00, 0x05, 0x03, 0x01,
+	0x00, 0x01, 0x07, 0x14, 0x02, 0x06, 0x6d, 0x65, 0x6d, 0x6f, 0x72, 0x79,
+	0x02, 0x00, 0x07, 0x63, 0x6f, 0x6d, 0x70, 0x75, 0x74, 0x65, 0x00, 0x00,
+	0x0a, 0x17, 0x01, 0x15, 0x00, 0x20, 0x01, 0x45, 0x04, 0x40, 0x41, 0x00,
+	0x0f, 0x0b, 0x20, 0x00, 0x20, 0x01, 0x41, 0x01, 0x6b, 0x10, 0x00, 0x0f,
+	0x0b,
+}
+
+// memoryGrowingModule is a hand-built WASM binary exporting a memory
+// (1 page, max 10) and a "compute(pages, _) -> i32" that grows the memory
+// by `pages` (its first parameter, the same slot ExecuteWithLimits passes
+// bufferPtr through as) in one call, then returns 0. It's enough to
+// exercise the memory listener's After hook catching growth mid-execution
+// without depending on lua.wasm.
+var memoryGrowingModule = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, 0x01, 0x07, 0x01, 0x60,
+	0x02, 0x7f, 0x7f, 0x01, 0x7f, 0x03, 0x02, 0x01, 0x00, 0x05, 0x04, 0x01,
+	0x01, 0x01, 0x0a, 0x07, 0x14, 0x02, 0x06, 0x6d, 0x65, 0x6d, 0x6f, 0x72,
+	0x79, 0x02, 0x00, 0x07, 0x63, 0x6f, 0x6d, 0x70, 0x75, 0x74, 0x65, 0x00,
+	0x00, 0x0a, 0x0c, 0x01, 0x0a, 0x00, 0x20, 0x00, 0x40, 0x00, 0x1a, 0x41,
+	0x00, 0x0f, 0x0b,
+}
+
+// tightLoopModule is a hand-built WASM binary exporting a 1-page memory and
+// a "compute(ptr, count) -> i32" that loops forever via a bare branch back
+// edge (the WAT equivalent of `loop br 0 end`) and never makes a single
+// WASM call instruction. It stands in for what a real Lua VM's bytecode
+// dispatch loop compiles to for something like "while true do end": the
+// fuel listener's Before hook only fires on calls, so this is the one case
+// neither Fuel nor MaxMemoryPages can ever catch, and ExecuteWithLimits'
+// Deadline only interrupts it if the runtime was built with
+// wazero.NewRuntimeConfig().WithCloseOnContextDone(true) — see instantiate.
+var tightLoopModule = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, 0x01, 0x07, 0x01, 0x60,
+	0x02, 0x7f, 0x7f, 0x01, 0x7f, 0x03, 0x02, 0x01, 0x00, 0x05, 0x03, 0x01,
+	0x00, 0x01, 0x07, 0x14, 0x02, 0x06, 0x6d, 0x65, 0x6d, 0x6f, 0x72, 0x79,
+	0x02, 0x00, 0x07, 0x63, 0x6f, 0x6d, 0x70, 0x75, 0x74, 0x65, 0x00, 0x00,
+	0x0a, 0x0a, 0x01, 0x08, 0x00, 0x03, 0x40, 0x0c, 0x00, 0x0b, 0x00, 0x0b,
+}
+
+// instantiate compiles wasmBytes with listeners wired in at compile time
+// (ListenerFactory only takes effect if installed before CompileModule —
+// see ListenerFactory's doc comment) and returns the instantiated module
+// along with its compute function and memory. The runtime is built with
+// WithCloseOnContextDone so it matches how LuaPool and the example binary
+// construct theirs (required for Deadline to interrupt a call-free loop
+// like tightLoopModule; see its doc comment).
+func instantiate(t *testing.T, wasmBytes []byte, listeners *ListenerFactory) (api.Module, api.Function, api.Memory) {
+	t.Helper()
+	ctx := context.Background()
+	r := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().WithCloseOnContextDone(true))
+	t.Cleanup(func() { r.Close(ctx) })
+
+	compileCtx := ctx
+	if listeners != nil {
+		compileCtx = listeners.OnContext(ctx)
+	}
+	compiled, err := r.CompileModule(compileCtx, wasmBytes)
+	if err != nil {
+		t.Fatalf("CompileModule: %v", err)
+	}
+	mod, err := r.InstantiateModule(ctx, compiled, wazero.NewModuleConfig().WithName("test"))
+	if err != nil {
+		t.Fatalf("InstantiateModule: %v", err)
+	}
+	return mod, mod.ExportedFunction("compute"), mod.Memory()
+}
+
+func TestExecuteWithLimitsTripsFuel(t *testing.T) {
+	listeners := NewListenerFactory()
+	mod, compute, memory := instantiate(t, recursingModule, listeners)
+
+	// recursingModule recurses len(code) times; ask for far more recursion
+	// than the fuel budget allows so the limit trips well before it would
+	// finish on its own.
+	code := strings.Repeat("x", 1000)
+	_, err := ExecuteWithLimits(context.Background(), listeners, mod, compute, memory, 0, 4096, code, Limits{Fuel: 5})
+
+	var limitErr *LimitExceededError
+	if !errors.As(err, &limitErr) || limitErr.Kind != LimitFuel {
+		t.Fatalf("ExecuteWithLimits: err = %v, want a *LimitExceededError{Kind: LimitFuel}", err)
+	}
+}
+
+func TestExecuteWithLimitsTripsMemory(t *testing.T) {
+	listeners := NewListenerFactory()
+	mod, compute, memory := instantiate(t, memoryGrowingModule, listeners)
+
+	// memoryGrowingModule grows memory by bufferPtr pages; ask it to grow
+	// from the module's starting 1 page to well past the 2-page limit.
+	_, err := ExecuteWithLimits(context.Background(), listeners, mod, compute, memory, 5, 65536, "", Limits{MaxMemoryPages: 2})
+
+	var limitErr *LimitExceededError
+	if !errors.As(err, &limitErr) || limitErr.Kind != LimitMemory {
+		t.Fatalf("ExecuteWithLimits: err = %v, want a *LimitExceededError{Kind: LimitMemory}", err)
+	}
+}
+
+// TestExecuteWithLimitsDeadlineInterruptsCallFreeLoop proves Deadline
+// actually aborts execution that never makes a single WASM call (the real
+// shape of an untrusted "while true do end"), not just the recursion-based
+// fixtures above that happen to check in at every call. Without the
+// runtime's WithCloseOnContextDone, this would block for the full 10s
+// below instead of returning a LimitExceededError around the 50ms
+// deadline.
+func TestExecuteWithLimitsDeadlineInterruptsCallFreeLoop(t *testing.T) {
+	mod, compute, memory := instantiate(t, tightLoopModule, nil)
+
+	start := time.Now()
+	_, err := ExecuteWithLimits(context.Background(), nil, mod, compute, memory, 0, 4096, "", Limits{Deadline: 50 * time.Millisecond})
+	elapsed := time.Since(start)
+
+	var limitErr *LimitExceededError
+	if !errors.As(err, &limitErr) || limitErr.Kind != LimitTime {
+		t.Fatalf("ExecuteWithLimits: err = %v, want a *LimitExceededError{Kind: LimitTime}", err)
+	}
+	if elapsed > 5*time.Second {
+		t.Fatalf("ExecuteWithLimits took %v to interrupt a call-free loop; Deadline isn't actually aborting it", elapsed)
+	}
+}
+
+func TestExecuteWithLimitsRejectsFuelWithoutListeners(t *testing.T) {
+	mod, compute, memory := instantiate(t, recursingModule, nil)
+
+	_, err := ExecuteWithLimits(context.Background(), nil, mod, compute, memory, 0, 4096, "", Limits{Fuel: 5})
+	if err == nil {
+		t.Fatal("expected error asking for Fuel with no ListenerFactory installed, got nil")
+	}
+}
+
+func TestLimitExceededErrorMessage(t *testing.T) {
+	err := &LimitExceededError{Kind: LimitFuel, Detail: "limit 100"}
+	want := "lualimits: fuel limit exceeded: limit 100"
+	if got := err.Error(); got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
+func TestLuaErrorMessage(t *testing.T) {
+	err := &LuaError{Message: "attempt to call a nil value"}
+	want := "lualimits: lua error: attempt to call a nil value"
+	if got := err.Error(); got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
+func TestLimitKindString(t *testing.T) {
+	cases := map[LimitKind]string{
+		LimitFuel:     "fuel",
+		LimitMemory:   "memory",
+		LimitTime:     "time",
+		LimitKind(99): "unknown",
+	}
+	for kind, want := range cases {
+		if got := kind.String(); got != want {
+			t.Errorf("LimitKind(%d).String() = %q, want %q", kind, got, want)
+		}
+	}
+}
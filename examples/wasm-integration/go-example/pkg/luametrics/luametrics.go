@@ -0,0 +1,144 @@
+// Package luametrics adds Prometheus metrics and OpenTelemetry tracing
+// around compute invocations. It's opt-in: a nil *Metrics is safe to call
+// everywhere and costs one nil check, so instrumentation stays off by
+// default with zero overhead.
+package luametrics
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Metrics holds every collector for one runtime. Construct with New and
+// pass the *Metrics (or nil to disable) through to instrumented call sites.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	computeDuration *prometheus.HistogramVec
+	computeBytesIn  prometheus.Counter
+	computeBytesOut prometheus.Counter
+	extTableOps     *prometheus.CounterVec
+	extTableBytes   prometheus.Counter
+	luaMemoryBytes  prometheus.Gauge
+	wasmPages       prometheus.Gauge
+
+	tracer trace.Tracer
+}
+
+// New creates and registers the cu_* collectors against a private registry
+// (never the global default, so embedding this example doesn't pollute a
+// host process's own metrics).
+func New() *Metrics {
+	registry := prometheus.NewRegistry()
+
+	m := &Metrics{
+		registry: registry,
+		computeDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "cu_compute_duration_seconds",
+			Help: "Duration of compute invocations by outcome.",
+		}, []string{"status"}),
+		computeBytesIn: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "cu_compute_bytes_in",
+			Help: "Total bytes of Lua source written to compute.",
+		}),
+		computeBytesOut: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "cu_compute_bytes_out",
+			Help: "Total bytes read back from compute results.",
+		}),
+		extTableOps: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "cu_ext_table_ops_total",
+			Help: "External table operations by kind.",
+		}, []string{"op"}),
+		extTableBytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "cu_ext_table_bytes",
+			Help: "Total bytes written to external tables.",
+		}),
+		luaMemoryBytes: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "cu_lua_memory_bytes",
+			Help: "Lua heap memory in use, as reported by get_memory_stats.",
+		}),
+		wasmPages: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "cu_wasm_pages",
+			Help: "WASM linear memory size, in 64KB pages.",
+		}),
+		tracer: otel.Tracer("cu/luametrics"),
+	}
+
+	registry.MustRegister(
+		m.computeDuration,
+		m.computeBytesIn,
+		m.computeBytesOut,
+		m.extTableOps,
+		m.extTableBytes,
+		m.luaMemoryBytes,
+		m.wasmPages,
+	)
+
+	return m
+}
+
+// Handler exposes the registered collectors for scraping. Mount it at
+// /metrics only when metrics are enabled.
+func (m *Metrics) Handler() http.Handler {
+	if m == nil {
+		return http.NotFoundHandler()
+	}
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// ObserveCompute records one compute invocation's duration and I/O size.
+// status should be "ok" or "error".
+func (m *Metrics) ObserveCompute(status string, dur time.Duration, bytesIn, bytesOut int) {
+	if m == nil {
+		return
+	}
+	m.computeDuration.WithLabelValues(status).Observe(dur.Seconds())
+	m.computeBytesIn.Add(float64(bytesIn))
+	m.computeBytesOut.Add(float64(bytesOut))
+}
+
+// ObserveExtTableOp records one external-table operation ("set", "get", or
+// "delete") and, for writes, the number of value bytes involved.
+func (m *Metrics) ObserveExtTableOp(op string, bytes int) {
+	if m == nil {
+		return
+	}
+	m.extTableOps.WithLabelValues(op).Inc()
+	if bytes > 0 {
+		m.extTableBytes.Add(float64(bytes))
+	}
+}
+
+// SetLuaMemoryUsed records the Lua heap size from the most recent
+// get_memory_stats call.
+func (m *Metrics) SetLuaMemoryUsed(bytes uint32) {
+	if m == nil {
+		return
+	}
+	m.luaMemoryBytes.Set(float64(bytes))
+}
+
+// SetWasmPages records the WASM linear memory size from the most recent
+// get_memory_stats call.
+func (m *Metrics) SetWasmPages(pages uint32) {
+	if m == nil {
+		return
+	}
+	m.wasmPages.Set(float64(pages))
+}
+
+// StartComputeSpan opens an OpenTelemetry span around a compute.Call so
+// users can trace end-to-end. With metrics disabled, it returns ctx
+// unchanged and a no-op span.
+func (m *Metrics) StartComputeSpan(ctx context.Context) (context.Context, trace.Span) {
+	if m == nil {
+		return ctx, trace.SpanFromContext(ctx)
+	}
+	return m.tracer.Start(ctx, "compute")
+}
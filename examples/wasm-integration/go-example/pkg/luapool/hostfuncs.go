@@ -0,0 +1,166 @@
+package luapool
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/tetratelabs/wazero/api"
+)
+
+// Host function implementations. When t.storage is set they delegate to it
+// directly, so a tableID persists no matter which slot serves the next
+// request for it; otherwise they fall back to the slot's own in-memory map.
+
+func (t *extTable) jsExtTableSet(ctx context.Context, m api.Module, tableID, keyPtr, keyLen, valPtr, valLen uint32) uint32 {
+	memory := m.Memory()
+
+	keyBytes, ok := memory.Read(keyPtr, keyLen)
+	if !ok {
+		return 1
+	}
+	valBytes, ok := memory.Read(valPtr, valLen)
+	if !ok {
+		return 1
+	}
+
+	if t.storage != nil {
+		if err := t.storage.Set(tableID, string(keyBytes), valBytes); err != nil {
+			return 1
+		}
+		t.metrics.ObserveExtTableOp("set", len(valBytes))
+		return 0
+	}
+
+	valueCopy := make([]byte, len(valBytes))
+	copy(valueCopy, valBytes)
+
+	t.mu.Lock()
+	t.values[key(tableID, string(keyBytes))] = valueCopy
+	t.mu.Unlock()
+
+	t.metrics.ObserveExtTableOp("set", len(valBytes))
+	return 0
+}
+
+func (t *extTable) jsExtTableGet(ctx context.Context, m api.Module, tableID, keyPtr, keyLen, valPtr, maxLen uint32) uint32 {
+	memory := m.Memory()
+
+	keyBytes, ok := memory.Read(keyPtr, keyLen)
+	if !ok {
+		return 0xFFFFFFFF
+	}
+
+	var value []byte
+	if t.storage != nil {
+		v, exists, err := t.storage.Get(tableID, string(keyBytes))
+		if err != nil || !exists {
+			return 0xFFFFFFFF
+		}
+		value = v
+	} else {
+		t.mu.Lock()
+		v, exists := t.values[key(tableID, string(keyBytes))]
+		t.mu.Unlock()
+		if !exists {
+			return 0xFFFFFFFF
+		}
+		value = v
+	}
+
+	if uint32(len(value)) > maxLen {
+		return 0xFFFFFFFF
+	}
+	if !memory.Write(valPtr, value) {
+		return 0xFFFFFFFF
+	}
+
+	t.metrics.ObserveExtTableOp("get", 0)
+	return uint32(len(value))
+}
+
+func (t *extTable) jsExtTableDelete(ctx context.Context, m api.Module, tableID, keyPtr, keyLen uint32) uint32 {
+	memory := m.Memory()
+
+	keyBytes, ok := memory.Read(keyPtr, keyLen)
+	if !ok {
+		return 1
+	}
+
+	if t.storage != nil {
+		if err := t.storage.Delete(tableID, string(keyBytes)); err != nil {
+			return 1
+		}
+		t.metrics.ObserveExtTableOp("delete", 0)
+		return 0
+	}
+
+	t.mu.Lock()
+	delete(t.values, key(tableID, string(keyBytes)))
+	t.mu.Unlock()
+
+	t.metrics.ObserveExtTableOp("delete", 0)
+	return 0
+}
+
+func (t *extTable) jsExtTableSize(ctx context.Context, m api.Module, tableID uint32) uint32 {
+	if t.storage != nil {
+		size, err := t.storage.Size(tableID)
+		if err != nil {
+			return 0
+		}
+		return uint32(size)
+	}
+
+	prefix := tablePrefix(tableID)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var count uint32
+	for k := range t.values {
+		if strings.HasPrefix(k, prefix) {
+			count++
+		}
+	}
+	return count
+}
+
+func (t *extTable) jsExtTableKeys(ctx context.Context, m api.Module, tableID, bufPtr, maxLen uint32) uint32 {
+	memory := m.Memory()
+
+	var keys []string
+	if t.storage != nil {
+		k, err := t.storage.Keys(tableID)
+		if err != nil {
+			return 0xFFFFFFFF
+		}
+		keys = k
+	} else {
+		prefix := tablePrefix(tableID)
+		t.mu.Lock()
+		for k := range t.values {
+			if rest, ok := strings.CutPrefix(k, prefix); ok {
+				keys = append(keys, rest)
+			}
+		}
+		t.mu.Unlock()
+	}
+
+	serialized := strings.Join(keys, "\n")
+	if uint32(len(serialized)) > maxLen {
+		return 0xFFFFFFFF
+	}
+	if !memory.Write(bufPtr, []byte(serialized)) {
+		return 0xFFFFFFFF
+	}
+
+	return uint32(len(serialized))
+}
+
+// tablePrefix namespaces keys by tableID within the slot's single flat map.
+func tablePrefix(tableID uint32) string {
+	return fmt.Sprintf("%d:", tableID)
+}
+
+func key(tableID uint32, k string) string {
+	return tablePrefix(tableID) + k
+}
@@ -0,0 +1,88 @@
+package luapool
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/twilson63/cu/examples/wasm-integration/go-example/pkg/lualimits"
+)
+
+// ExecuteWithLimits is Execute plus fuel, memory, and deadline enforcement,
+// so a server fronting untrusted tenants can cap any one request's cost.
+func (p *LuaPool) ExecuteWithLimits(ctx context.Context, code string, limits lualimits.Limits) (Result, error) {
+	var s *slot
+	select {
+	case s = <-p.sem:
+	case <-ctx.Done():
+		return Result{}, ctx.Err()
+	}
+	// returned is what goes back to the semaphore: normally s itself, but a
+	// tripped limit closes s.mod outright (lualimits.ExecuteWithLimits calls
+	// CloseWithExitCode), so s.init can never recover it. Swap in a freshly
+	// built replacement instead, or the pool's usable capacity shrinks by
+	// one every time a caller's fuel/deadline runs out.
+	returned := s
+	defer func() { p.sem <- returned }()
+
+	ctx, span := p.metrics.StartComputeSpan(ctx)
+	defer span.End()
+	start := time.Now()
+
+	resultBytes, err := lualimits.ExecuteWithLimits(ctx, p.listeners, s.mod, s.compute, s.memory, s.bufferPtr, s.bufferSize, code, limits)
+	if err != nil {
+		var luaErr *lualimits.LuaError
+		if errors.As(err, &luaErr) {
+			p.metrics.ObserveCompute("error", time.Since(start), len(code), len(luaErr.Message))
+			if syncErr := syncStorage(s.storage); syncErr != nil {
+				return Result{}, fmt.Errorf("sync external tables: %w", syncErr)
+			}
+			return Result{LuaError: luaErr.Message}, nil
+		}
+		p.metrics.ObserveCompute("error", time.Since(start), len(code), 0)
+
+		// A tripped limit (or the request ctx being canceled mid-run) makes
+		// lualimits.ExecuteWithLimits call CloseWithExitCode, so s.mod is
+		// gone for good; s.init can't bring a closed module back.
+		if s.mod.IsClosed() {
+			fresh, rebuildErr := p.newSlot(context.WithoutCancel(ctx), s.storage)
+			if rebuildErr != nil {
+				return Result{}, fmt.Errorf("%w (slot rebuild also failed: %v)", err, rebuildErr)
+			}
+			returned = fresh
+			return Result{}, err
+		}
+
+		if initErr := s.init(ctx); initErr != nil {
+			return Result{}, fmt.Errorf("%w (health check also failed: %v)", err, initErr)
+		}
+		return Result{}, err
+	}
+
+	p.metrics.ObserveCompute("ok", time.Since(start), len(code), len(resultBytes))
+	if syncErr := syncStorage(s.storage); syncErr != nil {
+		return Result{}, fmt.Errorf("sync external tables: %w", syncErr)
+	}
+	return parseComputeResult(resultBytes)
+}
+
+func parseComputeResult(resultBytes []byte) (Result, error) {
+	if len(resultBytes) == 0 {
+		return Result{}, nil
+	}
+	if len(resultBytes) < 4 {
+		return Result{}, fmt.Errorf("result too short to contain output length")
+	}
+
+	outputLen := binary.LittleEndian.Uint32(resultBytes[0:4])
+	if uint32(len(resultBytes)) < 4+outputLen {
+		return Result{}, fmt.Errorf("result truncated before declared output length")
+	}
+
+	return Result{
+		Output:      string(resultBytes[4 : 4+outputLen]),
+		ReturnBytes: resultBytes[4+outputLen:],
+	}, nil
+}
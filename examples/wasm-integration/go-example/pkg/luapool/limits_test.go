@@ -0,0 +1,38 @@
+package luapool
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/twilson63/cu/examples/wasm-integration/go-example/pkg/lualimits"
+)
+
+// TestExecuteWithLimitsRecoversSlotAfterDeadlineExceeded proves a single
+// tenant tripping its deadline can't permanently shrink the pool: the slot
+// lualimits.ExecuteWithLimits leaves behind has its module closed outright
+// (CloseWithExitCode), so s.init can never heal it — ExecuteWithLimits must
+// rebuild the slot instead of handing the dead one back to the semaphore.
+func TestExecuteWithLimitsRecoversSlotAfterDeadlineExceeded(t *testing.T) {
+	ctx := context.Background()
+	wasmBytes := loadWasmForBench(t)
+
+	pool, err := New(ctx, wasmBytes, Config{Size: 1})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer pool.Close(ctx)
+
+	_, err = pool.ExecuteWithLimits(ctx, "while true do end", lualimits.Limits{Deadline: 20 * time.Millisecond})
+	var limitErr *lualimits.LimitExceededError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("ExecuteWithLimits: err = %v, want a *lualimits.LimitExceededError", err)
+	}
+
+	// The pool has exactly one slot. If it wasn't rebuilt after the trip
+	// above, every call from here on fails against the closed module.
+	if _, err := pool.Execute(ctx, "return 2 + 2"); err != nil {
+		t.Fatalf("Execute after deadline trip: %v (pool capacity did not recover)", err)
+	}
+}
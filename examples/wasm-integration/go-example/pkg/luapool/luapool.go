@@ -0,0 +1,319 @@
+// Package luapool provides a fixed-size pool of precompiled lua.wasm
+// instances so concurrent, HTTP-style workloads don't serialize on a single
+// shared linear memory.
+package luapool
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+
+	"github.com/twilson63/cu/examples/wasm-integration/go-example/pkg/lualimits"
+	"github.com/twilson63/cu/examples/wasm-integration/go-example/pkg/luametrics"
+	"github.com/twilson63/cu/examples/wasm-integration/go-example/pkg/luastore"
+)
+
+// Result is the parsed outcome of a single compute invocation.
+type Result struct {
+	Output      string
+	ReturnBytes []byte
+	LuaError    string
+}
+
+// extTable is the external table scope a slot's host functions write
+// through. With no backing Storage, each slot gets its own isolated map, so
+// concurrent Execute calls never see each other's _home state. With a
+// backing Storage, all slots share it so a tableID means the same thing
+// across requests and across which slot happens to serve them.
+type extTable struct {
+	mu      sync.Mutex
+	values  map[string][]byte
+	storage luastore.Storage
+	metrics *luametrics.Metrics
+}
+
+func newExtTable(storage luastore.Storage, metrics *luametrics.Metrics) *extTable {
+	return &extTable{values: make(map[string][]byte), storage: storage, metrics: metrics}
+}
+
+// slot is one pooled module instance and the cached facts about it that
+// would otherwise require a round trip into wasm to rediscover. storage is
+// kept so a slot killed by a tripped limit (see ExecuteWithLimits) can be
+// rebuilt from scratch rather than leaving a permanent hole in the pool.
+type slot struct {
+	mod        api.Module
+	compute    api.Function
+	memory     api.Memory
+	initFunc   api.Function
+	bufferPtr  uint32
+	bufferSize uint32
+	table      *extTable
+	storage    luastore.Storage
+	metrics    *luametrics.Metrics
+}
+
+// LuaPool keeps a bounded set of module instances, all sharing one
+// precompiled wazero.CompiledModule, and checks them out under a semaphore
+// so the pool never exceeds Size concurrent executions.
+type LuaPool struct {
+	runtime  wazero.Runtime
+	compiled wazero.CompiledModule
+	sem      chan *slot
+
+	// listeners enforces ExecuteWithLimits' Fuel and MaxMemoryPages for
+	// every slot. It's wired into compiled below at compile time (wazero
+	// only reads a FunctionListenerFactory off the ctx passed to
+	// CompileModule), then shared by every slot's ExecuteWithLimits call,
+	// which registers and unregisters that slot's module per invocation.
+	listeners *lualimits.ListenerFactory
+
+	// nextSlotID hands out a fresh name suffix for every slot this pool ever
+	// builds, including rebuilds, so a replacement slot never collides with
+	// the host/guest module names of the dead one it's replacing.
+	nextSlotID atomic.Uint64
+
+	// metrics instruments every slot's compute and external-table calls.
+	// nil (the default) disables instrumentation at zero cost.
+	metrics *luametrics.Metrics
+}
+
+// Config controls pool construction.
+type Config struct {
+	// Size is the maximum number of concurrent module instances. Required.
+	Size int
+	// Storage, if set, backs every slot's external tables so a tableID
+	// persists across requests regardless of which slot serves them. If
+	// nil, each slot gets its own in-memory, per-slot-only table scope.
+	Storage luastore.Storage
+	// Metrics, if set, records compute duration/bytes and external-table
+	// op counts for every slot this pool builds. nil disables
+	// instrumentation.
+	Metrics *luametrics.Metrics
+}
+
+// New builds a LuaPool of cfg.Size module instances, each instantiated from
+// wasmBytes and given its own host-function environment and external table
+// scope.
+func New(ctx context.Context, wasmBytes []byte, cfg Config) (*LuaPool, error) {
+	if cfg.Size < 1 {
+		return nil, fmt.Errorf("luapool: size must be >= 1, got %d", cfg.Size)
+	}
+
+	// WithCloseOnContextDone is required for ExecuteWithLimits' Deadline
+	// (and Execute/ExecuteWithLimits' ctx cancellation) to actually
+	// interrupt a running compute call: without it, wazero's compiler
+	// engine only checks for a closed module at WASM call-instruction
+	// boundaries, so a tight loop with no calls (e.g. "while true do end")
+	// never notices CloseWithExitCode or ctx was canceled.
+	r := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().WithCloseOnContextDone(true))
+
+	listeners := lualimits.NewListenerFactory()
+	compiled, err := r.CompileModule(listeners.OnContext(ctx), wasmBytes)
+	if err != nil {
+		r.Close(ctx)
+		return nil, fmt.Errorf("luapool: compile module: %w", err)
+	}
+
+	pool := &LuaPool{
+		runtime:   r,
+		compiled:  compiled,
+		listeners: listeners,
+		sem:       make(chan *slot, cfg.Size),
+		metrics:   cfg.Metrics,
+	}
+
+	for i := 0; i < cfg.Size; i++ {
+		s, err := pool.newSlot(ctx, cfg.Storage)
+		if err != nil {
+			pool.Close(ctx)
+			return nil, fmt.Errorf("luapool: build slot %d: %w", i, err)
+		}
+		pool.sem <- s
+	}
+
+	return pool, nil
+}
+
+func (p *LuaPool) newSlot(ctx context.Context, storage luastore.Storage) (*slot, error) {
+	id := p.nextSlotID.Add(1)
+	table := newExtTable(storage, p.metrics)
+
+	envName := fmt.Sprintf("env-%d", id)
+	_, err := p.runtime.NewHostModuleBuilder(envName).
+		NewFunctionBuilder().WithFunc(table.jsExtTableSet).Export("js_ext_table_set").
+		NewFunctionBuilder().WithFunc(table.jsExtTableGet).Export("js_ext_table_get").
+		NewFunctionBuilder().WithFunc(table.jsExtTableDelete).Export("js_ext_table_delete").
+		NewFunctionBuilder().WithFunc(table.jsExtTableSize).Export("js_ext_table_size").
+		NewFunctionBuilder().WithFunc(table.jsExtTableKeys).Export("js_ext_table_keys").
+		Instantiate(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("instantiate host env: %w", err)
+	}
+
+	modConfig := wazero.NewModuleConfig().WithName(fmt.Sprintf("lua-%d", id))
+	mod, err := p.runtime.InstantiateModule(ctx, p.compiled, modConfig)
+	if err != nil {
+		return nil, fmt.Errorf("instantiate guest module: %w", err)
+	}
+
+	s := &slot{
+		mod:      mod,
+		compute:  mod.ExportedFunction("compute"),
+		memory:   mod.Memory(),
+		initFunc: mod.ExportedFunction("init"),
+		table:    table,
+		storage:  storage,
+		metrics:  p.metrics,
+	}
+
+	if err := s.init(ctx); err != nil {
+		return nil, err
+	}
+
+	bufferPtrResults, err := mod.ExportedFunction("get_buffer_ptr").Call(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get_buffer_ptr: %w", err)
+	}
+	s.bufferPtr = uint32(bufferPtrResults[0])
+
+	bufferSizeResults, err := mod.ExportedFunction("get_buffer_size").Call(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get_buffer_size: %w", err)
+	}
+	s.bufferSize = uint32(bufferSizeResults[0])
+
+	return s, nil
+}
+
+// init calls the module's init export and surfaces a non-zero return code
+// as an error. It also serves as the pool's health check: a fresh module
+// left dirty by a Lua-level panic is recovered by re-running init on it.
+func (s *slot) init(ctx context.Context) error {
+	results, err := s.initFunc.Call(ctx)
+	if err != nil {
+		return fmt.Errorf("init: %w", err)
+	}
+	if results[0] != 0 {
+		return fmt.Errorf("init returned error code %d", results[0])
+	}
+	return nil
+}
+
+// Execute checks out a module instance, runs code through compute, and
+// returns the parsed Result. It blocks until a slot is free or ctx is
+// canceled.
+func (p *LuaPool) Execute(ctx context.Context, code string) (Result, error) {
+	var s *slot
+	select {
+	case s = <-p.sem:
+	case <-ctx.Done():
+		return Result{}, ctx.Err()
+	}
+	// returned is what goes back to the semaphore: normally s itself, but
+	// the pool's runtime is built with WithCloseOnContextDone (see New), so
+	// ctx being canceled or hitting its deadline mid-call closes s.mod
+	// outright — not just under ExecuteWithLimits' explicit limits. s.init
+	// can never recover a closed module, so hand back a freshly built
+	// replacement instead, or the pool's usable capacity shrinks by one
+	// every time a caller's context runs out.
+	returned := s
+	defer func() { p.sem <- returned }()
+
+	result, err := s.execute(ctx, code)
+	if err != nil {
+		if s.mod.IsClosed() {
+			fresh, rebuildErr := p.newSlot(context.WithoutCancel(ctx), s.storage)
+			if rebuildErr != nil {
+				return result, fmt.Errorf("%w (slot rebuild also failed: %v)", err, rebuildErr)
+			}
+			returned = fresh
+			return result, err
+		}
+
+		// A failed invocation may have left Lua-level state (globals,
+		// in-flight coroutines) dirty; re-init before returning the slot.
+		if initErr := s.init(ctx); initErr != nil {
+			return result, fmt.Errorf("%w (health check also failed: %v)", err, initErr)
+		}
+		return result, err
+	}
+
+	if syncErr := syncStorage(s.storage); syncErr != nil {
+		return result, fmt.Errorf("sync external tables: %w", syncErr)
+	}
+	return result, nil
+}
+
+// syncStorage flushes storage, if it has opted into a Sync() error method
+// (as luastore.BoltStorage does) — the same type assertion main.go's
+// ExternalTables.Sync uses. Called after every successful invocation so a
+// Lua invocation's external-table writes land atomically, regardless of
+// whether the backend happens to commit each Set synchronously today; a
+// nil storage (no Config.Storage given) or a backend with nothing to flush
+// is a no-op.
+func syncStorage(storage luastore.Storage) error {
+	if storage == nil {
+		return nil
+	}
+	type syncer interface{ Sync() error }
+	if s, ok := storage.(syncer); ok {
+		return s.Sync()
+	}
+	return nil
+}
+
+func (s *slot) execute(ctx context.Context, code string) (Result, error) {
+	codeBytes := []byte(code)
+	if uint32(len(codeBytes)) > s.bufferSize {
+		return Result{}, fmt.Errorf("code too large for buffer")
+	}
+
+	if !s.memory.Write(s.bufferPtr, codeBytes) {
+		return Result{}, fmt.Errorf("failed to write code to buffer")
+	}
+
+	ctx, span := s.metrics.StartComputeSpan(ctx)
+	defer span.End()
+	start := time.Now()
+
+	results, err := s.compute.Call(ctx, uint64(s.bufferPtr), uint64(len(codeBytes)))
+	if err != nil {
+		s.metrics.ObserveCompute("error", time.Since(start), len(codeBytes), 0)
+		return Result{}, fmt.Errorf("compute failed: %w", err)
+	}
+
+	resultLen := int32(results[0])
+	if resultLen < 0 {
+		errorLen := -resultLen - 1
+		errorBytes, ok := s.memory.Read(s.bufferPtr, uint32(errorLen))
+		if !ok {
+			s.metrics.ObserveCompute("error", time.Since(start), len(codeBytes), 0)
+			return Result{}, fmt.Errorf("failed to read error message")
+		}
+		s.metrics.ObserveCompute("error", time.Since(start), len(codeBytes), len(errorBytes))
+		return Result{LuaError: string(errorBytes)}, nil
+	}
+	if resultLen == 0 {
+		s.metrics.ObserveCompute("ok", time.Since(start), len(codeBytes), 0)
+		return Result{}, nil
+	}
+
+	resultBytes, ok := s.memory.Read(s.bufferPtr, uint32(resultLen))
+	if !ok {
+		s.metrics.ObserveCompute("error", time.Since(start), len(codeBytes), 0)
+		return Result{}, fmt.Errorf("failed to read result")
+	}
+
+	s.metrics.ObserveCompute("ok", time.Since(start), len(codeBytes), len(resultBytes))
+	return parseComputeResult(resultBytes)
+}
+
+// Close tears down every module instance and the underlying runtime.
+func (p *LuaPool) Close(ctx context.Context) error {
+	return p.runtime.Close(ctx)
+}
@@ -0,0 +1,71 @@
+package luapool
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+)
+
+// loadWasmForBench locates lua.wasm the same way the example binary does.
+func loadWasmForBench(tb testing.TB) []byte {
+	tb.Helper()
+	paths := []string{
+		"../../../../../web/lua.wasm",
+		"../../../../web/lua.wasm",
+		"../../../web/lua.wasm",
+	}
+	for _, path := range paths {
+		if data, err := os.ReadFile(path); err == nil {
+			return data
+		}
+	}
+	tb.Skip("lua.wasm not found; skipping pool benchmark")
+	return nil
+}
+
+// BenchmarkExecuteSequential measures single-goroutine compute throughput
+// as a baseline for the concurrent benchmarks below.
+func BenchmarkExecuteSequential(b *testing.B) {
+	ctx := context.Background()
+	wasmBytes := loadWasmForBench(b)
+
+	pool, err := New(ctx, wasmBytes, Config{Size: 1})
+	if err != nil {
+		b.Fatalf("New: %v", err)
+	}
+	defer pool.Close(ctx)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := pool.Execute(ctx, "return 2 + 2"); err != nil {
+			b.Fatalf("Execute: %v", err)
+		}
+	}
+}
+
+// BenchmarkExecuteParallel measures compute throughput under N goroutines
+// sharing a pool, to demonstrate scaling as pool size grows.
+func BenchmarkExecuteParallel(b *testing.B) {
+	ctx := context.Background()
+	wasmBytes := loadWasmForBench(b)
+
+	for _, size := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			pool, err := New(ctx, wasmBytes, Config{Size: size})
+			if err != nil {
+				b.Fatalf("New: %v", err)
+			}
+			defer pool.Close(ctx)
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, err := pool.Execute(ctx, "return 2 + 2"); err != nil {
+						b.Fatalf("Execute: %v", err)
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package luapool
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/twilson63/cu/examples/wasm-integration/go-example/pkg/luametrics"
+	"github.com/twilson63/cu/examples/wasm-integration/go-example/pkg/luastore"
+)
+
+// tightLoopWasm is a hand-built WASM binary implementing the same "init /
+// get_buffer_ptr / get_buffer_size / compute" ABI as lua.wasm, except
+// compute ignores its arguments and loops forever via a bare branch
+// back-edge — no WASM call instructions in its hot path, so it can't be
+// interrupted by the fuel listener's call-based Before hook. It stands in
+// for what a real Lua VM's bytecode dispatch loop compiles to for
+// something like "while true do end", letting pool-level tests exercise
+// ctx cancellation against that exact shape without needing the real
+// lua.wasm checked in.
+var tightLoopWasm = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+	0x01, 0x0b, 0x02, 0x60, 0x00, 0x01, 0x7f, 0x60, 0x02, 0x7f, 0x7f, 0x01, 0x7f,
+	0x03, 0x05, 0x04, 0x00, 0x00, 0x00, 0x01,
+	0x05, 0x03, 0x01, 0x00, 0x01,
+	0x07, 0x3e, 0x05,
+	0x06, 0x6d, 0x65, 0x6d, 0x6f, 0x72, 0x79, 0x02, 0x00,
+	0x04, 0x69, 0x6e, 0x69, 0x74, 0x00, 0x00,
+	0x0e, 0x67, 0x65, 0x74, 0x5f, 0x62, 0x75, 0x66, 0x66, 0x65, 0x72, 0x5f, 0x70, 0x74, 0x72, 0x00, 0x01,
+	0x0f, 0x67, 0x65, 0x74, 0x5f, 0x62, 0x75, 0x66, 0x66, 0x65, 0x72, 0x5f, 0x73, 0x69, 0x7a, 0x65, 0x00, 0x02,
+	0x07, 0x63, 0x6f, 0x6d, 0x70, 0x75, 0x74, 0x65, 0x00, 0x03,
+	0x0a, 0x1a, 0x04,
+	0x04, 0x00, 0x41, 0x00, 0x0b,
+	0x04, 0x00, 0x41, 0x00, 0x0b,
+	0x05, 0x00, 0x41, 0x80, 0x02, 0x0b,
+	0x08, 0x00, 0x03, 0x40, 0x0c, 0x00, 0x0b, 0x00, 0x0b,
+}
+
+// TestExecuteRecoversSlotAfterContextDeadline proves a plain Execute call
+// (no explicit Limits) can't permanently shrink the pool either: the
+// runtime is built with WithCloseOnContextDone (see New), so a canceled or
+// expired ctx closes s.mod out from under Execute exactly as it does under
+// ExecuteWithLimits, and s.init can never heal a closed module.
+func TestExecuteRecoversSlotAfterContextDeadline(t *testing.T) {
+	ctx := context.Background()
+
+	pool, err := New(ctx, tightLoopWasm, Config{Size: 1})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer pool.Close(ctx)
+
+	cctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := pool.Execute(cctx, "while true do end"); err == nil {
+		t.Fatal("Execute: expected an error from the expired context, got nil")
+	}
+
+	// The pool has exactly one slot. tightLoopWasm's compute never returns
+	// on its own, so the only way to tell a healthy replacement slot apart
+	// from the dead one the bug left behind is to look at the module
+	// itself: a slot still holding the closed module would report
+	// IsClosed() forever, where the fix's rebuilt slot reports false.
+	s := <-pool.sem
+	defer func() { pool.sem <- s }()
+	if s.mod.IsClosed() {
+		t.Fatal("pool's only slot still holds the module the context deadline closed; it was never rebuilt")
+	}
+}
+
+// TestExecuteRecordsComputeMetrics proves Config.Metrics actually gets
+// exercised by Execute, not just threaded through and ignored: a
+// cu_compute_duration_seconds observation under the "error" label is the
+// only externally visible sign that LuaPool's compute path — as opposed to
+// the one-shot main.go demo — is wired to *luametrics.Metrics at all.
+func TestExecuteRecordsComputeMetrics(t *testing.T) {
+	ctx := context.Background()
+	metrics := luametrics.New()
+
+	pool, err := New(ctx, tightLoopWasm, Config{Size: 1, Metrics: metrics})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer pool.Close(ctx)
+
+	cctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := pool.Execute(cctx, "while true do end"); err == nil {
+		t.Fatal("Execute: expected an error from the expired context, got nil")
+	}
+
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.Contains(rec.Body.String(), `cu_compute_duration_seconds_count{status="error"} 1`) {
+		t.Fatalf("expected one error-status compute observation in scraped metrics, got:\n%s", rec.Body.String())
+	}
+}
+
+// syncCountingStorage wraps luastore.Storage and adds a Sync() method, the
+// same shape luastore.BoltStorage has, so syncStorage's type assertion
+// picks it up the way it would a real on-disk backend.
+type syncCountingStorage struct {
+	luastore.Storage
+	syncCalls int
+	syncErr   error
+}
+
+func (s *syncCountingStorage) Sync() error {
+	s.syncCalls++
+	return s.syncErr
+}
+
+func TestSyncStorageCallsSyncWhenImplemented(t *testing.T) {
+	storage := &syncCountingStorage{Storage: luastore.NewMemoryStorage()}
+
+	if err := syncStorage(storage); err != nil {
+		t.Fatalf("syncStorage: %v", err)
+	}
+	if storage.syncCalls != 1 {
+		t.Fatalf("syncCalls = %d, want 1", storage.syncCalls)
+	}
+}
+
+func TestSyncStoragePropagatesSyncError(t *testing.T) {
+	wantErr := errors.New("disk full")
+	storage := &syncCountingStorage{Storage: luastore.NewMemoryStorage(), syncErr: wantErr}
+
+	if err := syncStorage(storage); !errors.Is(err, wantErr) {
+		t.Fatalf("syncStorage: err = %v, want %v", err, wantErr)
+	}
+}
+
+func TestSyncStorageNoopWithoutSyncMethod(t *testing.T) {
+	// luastore.MemoryStorage has no Sync method; syncStorage must be a
+	// silent no-op rather than erroring, the same as main.go's
+	// ExternalTables.Sync treats it.
+	if err := syncStorage(luastore.NewMemoryStorage()); err != nil {
+		t.Fatalf("syncStorage: %v", err)
+	}
+}
+
+func TestSyncStorageNoopWithNilStorage(t *testing.T) {
+	// A pool built with no Config.Storage (each slot gets its own
+	// per-slot-only table) has nothing to flush.
+	if err := syncStorage(nil); err != nil {
+		t.Fatalf("syncStorage: %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+//go:build grpc
+
+// This file depends on pkg/luaserver/luaserverpb, generated from
+// luaserver.proto via the go:generate directive below. Since the generated
+// code isn't checked in (see .gitignore), this file is excluded from the
+// default build: run `go generate ./pkg/luaserver && go build -tags grpc
+// ./...` to build with gRPC support.
+//
+// Status: unfinished follow-up, not a shipped transport. Nothing in this
+// tree runs that go:generate step for you (no Makefile target, no CI job),
+// so this file has never actually been compiled or tested here — treat it
+// as a sketch of the intended gRPC surface, not a working one, until that
+// changes. HTTP (luaserver.go) is the supported way to reach Server today.
+
+package luaserver
+
+//go:generate protoc --go_out=. --go-grpc_out=. luaserver.proto
+
+import (
+	"encoding/json"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/twilson63/cu/examples/wasm-integration/go-example/pkg/luaserver/luaserverpb"
+	"github.com/twilson63/cu/examples/wasm-integration/go-example/pkg/luaval"
+)
+
+func millisToDuration(ms uint64) time.Duration {
+	return time.Duration(ms) * time.Millisecond
+}
+
+// grpcServer adapts Server to the generated EvalServiceServer interface.
+type grpcServer struct {
+	luaserverpb.UnimplementedEvalServiceServer
+	s *Server
+}
+
+// RegisterGRPC registers the EvalService on an existing *grpc.Server.
+func (s *Server) RegisterGRPC(gs *grpc.Server) {
+	luaserverpb.RegisterEvalServiceServer(gs, &grpcServer{s: s})
+}
+
+// Eval streams stdout as it's produced by the Lua code, followed by one
+// final chunk carrying the decoded result or error.
+func (g *grpcServer) Eval(req *luaserverpb.EvalRequest, stream luaserverpb.EvalService_EvalServer) error {
+	ctx := stream.Context()
+
+	result, err := g.s.pool.ExecuteWithLimits(ctx, req.GetCode(), g.s.Limits.clamp(req.GetFuel(), millisToDuration(req.GetTimeoutMs())))
+	if err != nil {
+		return stream.Send(&luaserverpb.EvalChunk{Done: true, Error: err.Error()})
+	}
+
+	if result.Output != "" {
+		if err := stream.Send(&luaserverpb.EvalChunk{Stdout: result.Output}); err != nil {
+			return err
+		}
+	}
+
+	final := &luaserverpb.EvalChunk{Done: true, Error: result.LuaError}
+	if len(result.ReturnBytes) > 0 {
+		value, err := luaval.Decode(result.ReturnBytes)
+		if err != nil {
+			return stream.Send(&luaserverpb.EvalChunk{Done: true, Error: err.Error()})
+		}
+		resultJSON, err := json.Marshal(value)
+		if err != nil {
+			return stream.Send(&luaserverpb.EvalChunk{Done: true, Error: err.Error()})
+		}
+		final.ResultJson = string(resultJSON)
+	}
+
+	return stream.Send(final)
+}
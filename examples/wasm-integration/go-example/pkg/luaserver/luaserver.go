@@ -0,0 +1,269 @@
+// Package luaserver wraps a LuaPool as a network service: an HTTP API for
+// eval and out-of-band external-table management. HTTP is the shipped,
+// tested surface in this file. A gRPC counterpart is sketched in
+// luaserver.proto and grpc.go for a streaming Eval, but it's an unfinished
+// follow-up, not an alternative transport you can build today: the
+// generated luaserverpb package isn't checked in, so `go build -tags grpc
+// ./...` doesn't compile until someone runs the go:generate directive in
+// grpc.go with protoc and the Go plugins installed.
+package luaserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/twilson63/cu/examples/wasm-integration/go-example/pkg/lualimits"
+	"github.com/twilson63/cu/examples/wasm-integration/go-example/pkg/luametrics"
+	"github.com/twilson63/cu/examples/wasm-integration/go-example/pkg/luapool"
+	"github.com/twilson63/cu/examples/wasm-integration/go-example/pkg/luastore"
+	"github.com/twilson63/cu/examples/wasm-integration/go-example/pkg/luaval"
+)
+
+// Server backs the HTTP and gRPC endpoints with a shared pool and storage,
+// so a tableID means the same thing across both.
+type Server struct {
+	pool    *luapool.LuaPool
+	storage luastore.Storage
+
+	// Limits bounds every /eval and gRPC Eval invocation, regardless of
+	// what the request asks for. Defaults to DefaultLimitPolicy; tune it
+	// after construction if the default budget doesn't fit the deployment.
+	Limits LimitPolicy
+
+	// Metrics backs the /metrics endpoint Mux registers. It's independent
+	// of pool's own Config.Metrics (which instruments compute and
+	// external-table calls inside LuaPool) — pass the same *luametrics.Metrics
+	// to both so every cu_* series comes from one registry. nil (the
+	// default) makes /metrics 404, per luametrics.Metrics.Handler.
+	Metrics *luametrics.Metrics
+}
+
+// New builds a Server. storage is used for the out-of-band /table
+// endpoints; pool should have been constructed with the same storage as
+// its Config.Storage so evaluated code sees out-of-band writes.
+func New(pool *luapool.LuaPool, storage luastore.Storage) *Server {
+	return &Server{pool: pool, storage: storage, Limits: DefaultLimitPolicy}
+}
+
+// LimitPolicy bounds the fuel and deadline a single eval request may run
+// with. It's applied to every request regardless of what the caller sends,
+// including the all-zero case (a client that omits fuel/timeout entirely),
+// so one tenant can never run unmetered and starve the pool for everyone
+// else.
+type LimitPolicy struct {
+	// DefaultFuel is used when a request omits Fuel (leaves it zero).
+	DefaultFuel uint64
+	// MinFuel and MaxFuel clamp whatever the request asks for.
+	MinFuel, MaxFuel uint64
+
+	// DefaultDeadline is used when a request omits Timeout (leaves it zero).
+	DefaultDeadline time.Duration
+	// MinDeadline and MaxDeadline clamp whatever the request asks for.
+	MinDeadline, MaxDeadline time.Duration
+}
+
+// DefaultLimitPolicy is the policy New assigns to every Server. It's
+// generous enough for typical scripts but still bounds every invocation.
+var DefaultLimitPolicy = LimitPolicy{
+	DefaultFuel: 1_000_000,
+	MinFuel:     1,
+	MaxFuel:     50_000_000,
+
+	DefaultDeadline: 5 * time.Second,
+	MinDeadline:     time.Millisecond,
+	MaxDeadline:     30 * time.Second,
+}
+
+// clamp turns a caller-supplied fuel/deadline pair into the Limits actually
+// enforced: zero values fall back to the policy default, and anything
+// outside [Min, Max] is pulled back into range.
+func (p LimitPolicy) clamp(fuel uint64, deadline time.Duration) lualimits.Limits {
+	if fuel == 0 {
+		fuel = p.DefaultFuel
+	}
+	fuel = clampUint64(fuel, p.MinFuel, p.MaxFuel)
+
+	if deadline == 0 {
+		deadline = p.DefaultDeadline
+	}
+	deadline = clampDuration(deadline, p.MinDeadline, p.MaxDeadline)
+
+	return lualimits.Limits{Fuel: fuel, Deadline: deadline}
+}
+
+func clampUint64(v, min, max uint64) uint64 {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+func clampDuration(v, min, max time.Duration) time.Duration {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+// Mux returns the HTTP routes for this server, suitable for
+// http.ListenAndServe or mounting under a larger mux.
+func (s *Server) Mux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /eval", s.handleEval)
+	mux.HandleFunc("POST /table/{id}/kv", s.handleTableSet)
+	mux.HandleFunc("GET /table/{id}/keys", s.handleTableKeys)
+	mux.HandleFunc("DELETE /table/{id}/{key}", s.handleTableDelete)
+	// s.Metrics is read per request, not captured here, so setting it after
+	// New (the same way Limits is tuned) still takes effect.
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		s.Metrics.Handler().ServeHTTP(w, r)
+	})
+	return mux
+}
+
+// evalRequest's Timeout and Fuel are a ceiling request, not a guarantee:
+// the server clamps both into Server.Limits before running anything (see
+// handleEval), so a client that omits either still gets a metered run.
+//
+// There's no tableId here: compute's wasm ABI has no notion of "the table
+// this invocation should use" — js_ext_table_* calls carry their own
+// tableID chosen by the Lua guest itself. Per-request table scoping isn't
+// implemented; use the out-of-band /table/{id}/kv endpoints, which are
+// scoped by path, not by anything in the eval request.
+type evalRequest struct {
+	Code    string        `json:"code"`
+	Timeout time.Duration `json:"timeout"`
+	Fuel    uint64        `json:"fuel"`
+}
+
+type evalResponse struct {
+	Output string          `json:"output,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// maxEvalBodyBytes bounds a /eval request body, so an untrusted tenant
+// can't exhaust memory by streaming an oversized body at the JSON decoder
+// before fuel/deadline limits ever get a chance to apply.
+const maxEvalBodyBytes = 1 << 20 // 1MiB
+
+func (s *Server) handleEval(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxEvalBodyBytes)
+
+	var req evalRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	result, err := s.pool.ExecuteWithLimits(r.Context(), req.Code, s.Limits.clamp(req.Fuel, req.Timeout))
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	resp := evalResponse{Output: result.Output, Error: result.LuaError}
+	if len(result.ReturnBytes) > 0 {
+		value, err := luaval.Decode(result.ReturnBytes)
+		if err != nil {
+			httpError(w, http.StatusInternalServerError, err)
+			return
+		}
+		resultJSON, err := json.Marshal(value)
+		if err != nil {
+			httpError(w, http.StatusInternalServerError, err)
+			return
+		}
+		resp.Result = resultJSON
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+type kvRequest struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
+
+func (s *Server) handleTableSet(w http.ResponseWriter, r *http.Request) {
+	tableID, err := parseTableID(r.PathValue("id"))
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var req kvRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := s.storage.Set(tableID, req.Key, req.Value); err != nil {
+		httpError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleTableKeys(w http.ResponseWriter, r *http.Request) {
+	tableID, err := parseTableID(r.PathValue("id"))
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	keys, err := s.storage.Keys(tableID)
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Keys []string `json:"keys"`
+	}{Keys: keys})
+}
+
+func (s *Server) handleTableDelete(w http.ResponseWriter, r *http.Request) {
+	tableID, err := parseTableID(r.PathValue("id"))
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := s.storage.Delete(tableID, r.PathValue("key")); err != nil {
+		httpError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func parseTableID(raw string) (uint32, error) {
+	id, err := strconv.ParseUint(raw, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid table id %q: %w", raw, err)
+	}
+	return uint32(id), nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func httpError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, struct {
+		Error string `json:"error"`
+	}{Error: err.Error()})
+}
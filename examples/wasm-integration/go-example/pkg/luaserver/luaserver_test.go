@@ -0,0 +1,304 @@
+package luaserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/twilson63/cu/examples/wasm-integration/go-example/pkg/luametrics"
+	"github.com/twilson63/cu/examples/wasm-integration/go-example/pkg/luapool"
+	"github.com/twilson63/cu/examples/wasm-integration/go-example/pkg/luastore"
+)
+
+// loadWasmForTest locates lua.wasm the same way the example binary does.
+func loadWasmForTest(t *testing.T) []byte {
+	t.Helper()
+	paths := []string{
+		"../../../../../web/lua.wasm",
+		"../../../../web/lua.wasm",
+		"../../../web/lua.wasm",
+	}
+	for _, path := range paths {
+		if data, err := os.ReadFile(path); err == nil {
+			return data
+		}
+	}
+	t.Skip("lua.wasm not found; skipping luaserver integration test")
+	return nil
+}
+
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	return newTestServerWithWasm(t, loadWasmForTest(t))
+}
+
+func newTestServerWithWasm(t *testing.T, wasmBytes []byte) *httptest.Server {
+	t.Helper()
+	ctx := t.Context()
+	storage := luastore.NewMemoryStorage()
+
+	pool, err := luapool.New(ctx, wasmBytes, luapool.Config{Size: 2, Storage: storage})
+	if err != nil {
+		t.Fatalf("luapool.New: %v", err)
+	}
+	t.Cleanup(func() { pool.Close(ctx) })
+
+	srv := New(pool, storage)
+	ts := httptest.NewServer(srv.Mux())
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// tightLoopWasm is a hand-built WASM binary implementing the same "init /
+// get_buffer_ptr / get_buffer_size / compute" ABI as lua.wasm, except
+// compute ignores its arguments and loops forever via a bare branch
+// back-edge — no WASM call instructions in its hot path. It stands in for
+// what a real Lua VM's bytecode dispatch loop compiles to for something
+// like "while true do end", letting this test exercise the daemon's
+// deadline enforcement against that exact shape without needing the real
+// lua.wasm checked in.
+var tightLoopWasm = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+	0x01, 0x0b, 0x02, 0x60, 0x00, 0x01, 0x7f, 0x60, 0x02, 0x7f, 0x7f, 0x01, 0x7f,
+	0x03, 0x05, 0x04, 0x00, 0x00, 0x00, 0x01,
+	0x05, 0x03, 0x01, 0x00, 0x01,
+	0x07, 0x3e, 0x05,
+	0x06, 0x6d, 0x65, 0x6d, 0x6f, 0x72, 0x79, 0x02, 0x00,
+	0x04, 0x69, 0x6e, 0x69, 0x74, 0x00, 0x00,
+	0x0e, 0x67, 0x65, 0x74, 0x5f, 0x62, 0x75, 0x66, 0x66, 0x65, 0x72, 0x5f, 0x70, 0x74, 0x72, 0x00, 0x01,
+	0x0f, 0x67, 0x65, 0x74, 0x5f, 0x62, 0x75, 0x66, 0x66, 0x65, 0x72, 0x5f, 0x73, 0x69, 0x7a, 0x65, 0x00, 0x02,
+	0x07, 0x63, 0x6f, 0x6d, 0x70, 0x75, 0x74, 0x65, 0x00, 0x03,
+	0x0a, 0x1a, 0x04,
+	0x04, 0x00, 0x41, 0x00, 0x0b,
+	0x04, 0x00, 0x41, 0x00, 0x0b,
+	0x05, 0x00, 0x41, 0x80, 0x02, 0x0b,
+	0x08, 0x00, 0x03, 0x40, 0x0c, 0x00, 0x0b, 0x00, 0x0b,
+}
+
+// TestEvalInterruptsCallFreeRunawayCompute proves a POST /eval can't wedge
+// a pool slot forever just because the guest's hot path makes no WASM
+// calls (the shape a real "while true do end" compiles to, which the
+// call-based recursion fixtures elsewhere can't exercise). Before LuaPool's
+// runtime was built with wazero.NewRuntimeConfig().WithCloseOnContextDone,
+// this request would never return even though the server always clamps it
+// to Server.Limits.
+func TestEvalInterruptsCallFreeRunawayCompute(t *testing.T) {
+	ts := newTestServerWithWasm(t, tightLoopWasm)
+
+	body, _ := json.Marshal(evalRequest{Code: "while true do end", Timeout: 50 * time.Millisecond})
+	start := time.Now()
+	resp, err := http.Post(ts.URL+"/eval", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST /eval: %v", err)
+	}
+	defer resp.Body.Close()
+	elapsed := time.Since(start)
+
+	if elapsed > 5*time.Second {
+		t.Fatalf("POST /eval took %v to return; the runaway compute call was not interrupted", elapsed)
+	}
+
+	var out evalResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if out.Error == "" {
+		t.Fatalf("expected a time-limit error for a runaway compute call, got %+v", out)
+	}
+}
+
+// TestEvalRejectsOversizedBody proves a /eval request body beyond
+// maxEvalBodyBytes is rejected outright instead of being decoded in full,
+// so an untrusted tenant can't exhaust server memory by streaming an
+// oversized body ahead of any fuel/deadline enforcement.
+func TestEvalRejectsOversizedBody(t *testing.T) {
+	ts := newTestServerWithWasm(t, tightLoopWasm)
+
+	oversized, err := json.Marshal(evalRequest{Code: string(make([]byte, maxEvalBodyBytes+1))})
+	if err != nil {
+		t.Fatalf("marshal oversized request: %v", err)
+	}
+
+	resp, err := http.Post(ts.URL+"/eval", "application/json", bytes.NewReader(oversized))
+	if err != nil {
+		t.Fatalf("POST /eval: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
+
+// TestMetricsEndpoint proves /metrics stays 404 with no Metrics set (the
+// default, matching luametrics.Metrics.Handler's own nil-safe behavior) and
+// becomes scrapeable the moment a caller sets Server.Metrics, the same
+// "configure after New" pattern Limits uses.
+func TestMetricsEndpoint(t *testing.T) {
+	ctx := t.Context()
+	storage := luastore.NewMemoryStorage()
+
+	pool, err := luapool.New(ctx, tightLoopWasm, luapool.Config{Size: 1, Storage: storage})
+	if err != nil {
+		t.Fatalf("luapool.New: %v", err)
+	}
+	t.Cleanup(func() { pool.Close(ctx) })
+
+	srv := New(pool, storage)
+	ts := httptest.NewServer(srv.Mux())
+	t.Cleanup(ts.Close)
+
+	resp, err := http.Get(ts.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("GET /metrics: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("GET /metrics with no Metrics set: status = %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+
+	srv.Metrics = luametrics.New()
+	resp, err = http.Get(ts.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("GET /metrics: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /metrics with Metrics set: status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+}
+
+func TestEvalCounterPersistsAcrossRequests(t *testing.T) {
+	ts := newTestServer(t)
+
+	eval := func(code string) evalResponse {
+		t.Helper()
+		body, _ := json.Marshal(evalRequest{Code: code})
+		resp, err := http.Post(ts.URL+"/eval", "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("POST /eval: %v", err)
+		}
+		defer resp.Body.Close()
+
+		var out evalResponse
+		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		return out
+	}
+
+	code := "_home.counter = (_home.counter or 0) + 1; return _home.counter"
+	first := eval(code)
+	second := eval(code)
+
+	if first.Error != "" || second.Error != "" {
+		t.Fatalf("unexpected Lua errors: %q, %q", first.Error, second.Error)
+	}
+	if string(first.Result) == string(second.Result) {
+		t.Fatalf("expected counter to advance across requests, got %q twice", first.Result)
+	}
+}
+
+func TestTableKVEndpoints(t *testing.T) {
+	ts := newTestServer(t)
+
+	body, _ := json.Marshal(kvRequest{Key: "greeting", Value: []byte("hi")})
+	resp, err := http.Post(ts.URL+"/table/1/kv", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST /table/1/kv: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("POST /table/1/kv: status = %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(ts.URL + "/table/1/keys")
+	if err != nil {
+		t.Fatalf("GET /table/1/keys: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var got struct {
+		Keys []string `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("decode keys response: %v", err)
+	}
+	if len(got.Keys) != 1 || got.Keys[0] != "greeting" {
+		t.Fatalf("keys = %v, want [greeting]", got.Keys)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, ts.URL+"/table/1/greeting", nil)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("DELETE /table/1/greeting: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("DELETE /table/1/greeting: status = %d", resp.StatusCode)
+	}
+}
+
+func TestLimitPolicyClampAppliesDefaultsAndBounds(t *testing.T) {
+	policy := LimitPolicy{
+		DefaultFuel:     100,
+		MinFuel:         10,
+		MaxFuel:         1000,
+		DefaultDeadline: time.Second,
+		MinDeadline:     10 * time.Millisecond,
+		MaxDeadline:     time.Minute,
+	}
+
+	cases := []struct {
+		name         string
+		fuel         uint64
+		deadline     time.Duration
+		wantFuel     uint64
+		wantDeadline time.Duration
+	}{
+		{"zero values fall back to defaults", 0, 0, 100, time.Second},
+		{"in-range values pass through", 500, 5 * time.Second, 500, 5 * time.Second},
+		{"fuel below min is raised", 1, 0, 10, time.Second},
+		{"fuel above max is capped", 1_000_000, 0, 1000, time.Second},
+		{"deadline below min is raised", 0, time.Microsecond, 100, 10 * time.Millisecond},
+		{"deadline above max is capped", 0, time.Hour, 100, time.Minute},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := policy.clamp(tc.fuel, tc.deadline)
+			if got.Fuel != tc.wantFuel || got.Deadline != tc.wantDeadline {
+				t.Errorf("clamp(%d, %s) = {Fuel: %d, Deadline: %s}, want {Fuel: %d, Deadline: %s}",
+					tc.fuel, tc.deadline, got.Fuel, got.Deadline, tc.wantFuel, tc.wantDeadline)
+			}
+		})
+	}
+}
+
+// A request that omits fuel/timeout entirely — the normal, non-adversarial
+// case — must still come back metered rather than running unbounded.
+func TestEvalWithoutLimitsIsStillMetered(t *testing.T) {
+	ts := newTestServer(t)
+
+	body, _ := json.Marshal(evalRequest{Code: "return 2 + 2"})
+	resp, err := http.Post(ts.URL+"/eval", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST /eval: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var out evalResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if out.Error != "" {
+		t.Fatalf("unexpected error: %q", out.Error)
+	}
+	if string(out.Result) != "4" {
+		t.Fatalf("result = %q, want %q", out.Result, "4")
+	}
+}
@@ -0,0 +1,189 @@
+// Package luasnapshot checkpoints a warmed-up Lua VM (post-init,
+// post-library-load) as a versioned binary blob, so callers can fork many
+// workers from one snapshot instead of re-running init on each.
+package luasnapshot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/tetratelabs/wazero/api"
+
+	"github.com/twilson63/cu/examples/wasm-integration/go-example/pkg/luastore"
+)
+
+// magic identifies a luasnapshot blob; version allows the format to evolve
+// without silently misreading an older or foreign blob.
+var magic = [4]byte{'C', 'U', 'S', 'N'}
+
+const version = 1
+
+// SnapshotVM captures mod's entire linear memory plus the external table
+// contents named by tableIDs into a single binary blob. The blob is:
+//
+//	magic(4) version(1) pageCount(4) zstdLen(8) zstd(memory pages)
+//	tableCount(4) [tableID(4) keyCount(4) [keyLen(4) key keyLen(4) value]...]...
+func SnapshotVM(ctx context.Context, mod api.Module, storage luastore.Storage, tableIDs []uint32) ([]byte, error) {
+	memory := mod.Memory()
+	if memory == nil {
+		return nil, fmt.Errorf("luasnapshot: module has no exported memory")
+	}
+
+	pageCount := memory.Size() / wasmPageSize
+	pages, ok := memory.Read(0, memory.Size())
+	if !ok {
+		return nil, fmt.Errorf("luasnapshot: failed to read linear memory")
+	}
+
+	var compressed bytes.Buffer
+	zw, err := zstd.NewWriter(&compressed)
+	if err != nil {
+		return nil, fmt.Errorf("luasnapshot: new zstd writer: %w", err)
+	}
+	if _, err := zw.Write(pages); err != nil {
+		zw.Close()
+		return nil, fmt.Errorf("luasnapshot: compress memory: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("luasnapshot: close zstd writer: %w", err)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(magic[:])
+	buf.WriteByte(version)
+	writeUint32(&buf, pageCount)
+	writeUint64(&buf, uint64(compressed.Len()))
+	buf.Write(compressed.Bytes())
+
+	writeUint32(&buf, uint32(len(tableIDs)))
+	for _, tableID := range tableIDs {
+		keys, err := storage.Keys(tableID)
+		if err != nil {
+			return nil, fmt.Errorf("luasnapshot: list keys for table %d: %w", tableID, err)
+		}
+
+		writeUint32(&buf, tableID)
+		writeUint32(&buf, uint32(len(keys)))
+		for _, key := range keys {
+			value, ok, err := storage.Get(tableID, key)
+			if err != nil {
+				return nil, fmt.Errorf("luasnapshot: read table %d key %q: %w", tableID, key, err)
+			}
+			if !ok {
+				continue
+			}
+			writeLenPrefixed(&buf, []byte(key))
+			writeLenPrefixed(&buf, value)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// RestoreVM reverses SnapshotVM: it grows mod's memory to the recorded page
+// count, writes the captured pages back, and repopulates storage with the
+// snapshot's table contents. mod should be a freshly instantiated module
+// (post-init) so restored tables don't collide with leftover state.
+func RestoreVM(ctx context.Context, mod api.Module, storage luastore.Storage, snap []byte) error {
+	r := bytes.NewReader(snap)
+
+	var gotMagic [4]byte
+	if _, err := io.ReadFull(r, gotMagic[:]); err != nil {
+		return fmt.Errorf("luasnapshot: read magic: %w", err)
+	}
+	if gotMagic != magic {
+		return fmt.Errorf("luasnapshot: not a luasnapshot blob (bad magic)")
+	}
+
+	gotVersion, err := r.ReadByte()
+	if err != nil {
+		return fmt.Errorf("luasnapshot: read version: %w", err)
+	}
+	if gotVersion != version {
+		return fmt.Errorf("luasnapshot: unsupported version %d (want %d)", gotVersion, version)
+	}
+
+	pageCount, err := readUint32(r)
+	if err != nil {
+		return fmt.Errorf("luasnapshot: read page count: %w", err)
+	}
+
+	zstdLen, err := readUint64(r)
+	if err != nil {
+		return fmt.Errorf("luasnapshot: read compressed length: %w", err)
+	}
+	if zstdLen > uint64(r.Len()) {
+		return fmt.Errorf("luasnapshot: compressed length %d exceeds %d remaining bytes", zstdLen, r.Len())
+	}
+	compressed := make([]byte, zstdLen)
+	if _, err := io.ReadFull(r, compressed); err != nil {
+		return fmt.Errorf("luasnapshot: read compressed memory: %w", err)
+	}
+
+	zr, err := zstd.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return fmt.Errorf("luasnapshot: new zstd reader: %w", err)
+	}
+	defer zr.Close()
+
+	// wantLen is the exact size restoring pageCount pages writes into
+	// memory; cap the read one byte past it so an adversarial or corrupted
+	// blob with a high compression ratio can't force an arbitrarily large
+	// allocation via io.ReadAll before pageCount is ever consulted, and so
+	// a short or long decompression is caught below instead of silently
+	// restoring a truncated or oversized memory image.
+	wantLen := uint64(pageCount) * wasmPageSize
+	pages, err := io.ReadAll(io.LimitReader(zr, int64(wantLen)+1))
+	if err != nil {
+		return fmt.Errorf("luasnapshot: decompress memory: %w", err)
+	}
+	if uint64(len(pages)) != wantLen {
+		return fmt.Errorf("luasnapshot: decompressed memory is %d bytes, want exactly %d (%d pages)", len(pages), wantLen, pageCount)
+	}
+
+	memory := mod.Memory()
+	if memory == nil {
+		return fmt.Errorf("luasnapshot: module has no exported memory")
+	}
+	if currentPages := memory.Size() / wasmPageSize; currentPages < pageCount {
+		if _, ok := memory.Grow(pageCount - currentPages); !ok {
+			return fmt.Errorf("luasnapshot: failed to grow memory to %d pages", pageCount)
+		}
+	}
+	if !memory.Write(0, pages) {
+		return fmt.Errorf("luasnapshot: failed to write restored memory")
+	}
+
+	tableCount, err := readUint32(r)
+	if err != nil {
+		return fmt.Errorf("luasnapshot: read table count: %w", err)
+	}
+	for i := uint32(0); i < tableCount; i++ {
+		tableID, err := readUint32(r)
+		if err != nil {
+			return fmt.Errorf("luasnapshot: read table id: %w", err)
+		}
+		keyCount, err := readUint32(r)
+		if err != nil {
+			return fmt.Errorf("luasnapshot: read key count for table %d: %w", tableID, err)
+		}
+		for j := uint32(0); j < keyCount; j++ {
+			key, err := readLenPrefixed(r)
+			if err != nil {
+				return fmt.Errorf("luasnapshot: read key for table %d: %w", tableID, err)
+			}
+			value, err := readLenPrefixed(r)
+			if err != nil {
+				return fmt.Errorf("luasnapshot: read value for table %d key %q: %w", tableID, key, err)
+			}
+			if err := storage.Set(tableID, string(key), value); err != nil {
+				return fmt.Errorf("luasnapshot: restore table %d key %q: %w", tableID, key, err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,171 @@
+package luasnapshot
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/tetratelabs/wazero"
+
+	"github.com/twilson63/cu/examples/wasm-integration/go-example/pkg/luastore"
+)
+
+// minimalMemoryModule is a hand-built WASM binary exporting a 1-page memory
+// named "memory" and nothing else. It's enough to exercise SnapshotVM and
+// RestoreVM against a real api.Module without depending on lua.wasm.
+var minimalMemoryModule = []byte{
+	0x00, 0x61, 0x73, 0x6d, // magic "\0asm"
+	0x01, 0x00, 0x00, 0x00, // version 1
+	// memory section (id 5): 1 memory, min 1 page
+	0x05, 0x03, 0x01, 0x00, 0x01,
+	// export section (id 7): export memory[0] as "memory"
+	0x07, 0x0a, 0x01, 0x06, 'm', 'e', 'm', 'o', 'r', 'y', 0x02, 0x00,
+}
+
+func TestSnapshotRestoreRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	r := wazero.NewRuntime(ctx)
+	defer r.Close(ctx)
+
+	compiled, err := r.CompileModule(ctx, minimalMemoryModule)
+	if err != nil {
+		t.Fatalf("CompileModule: %v", err)
+	}
+
+	mod, err := r.InstantiateModule(ctx, compiled, wazero.NewModuleConfig().WithName("snapshot-src"))
+	if err != nil {
+		t.Fatalf("InstantiateModule: %v", err)
+	}
+
+	memory := mod.Memory()
+	want := []byte("hello from the vm")
+	if !memory.Write(0, want) {
+		t.Fatalf("failed to seed memory")
+	}
+
+	storage := luastore.NewMemoryStorage()
+	if err := storage.Set(1, "counter", []byte("41")); err != nil {
+		t.Fatalf("seed storage: %v", err)
+	}
+
+	snap, err := SnapshotVM(ctx, mod, storage, []uint32{1})
+	if err != nil {
+		t.Fatalf("SnapshotVM: %v", err)
+	}
+
+	// Mutate the source module's memory and storage after the snapshot, to
+	// prove restore doesn't just read back live state.
+	if !memory.Write(0, make([]byte, len(want))) {
+		t.Fatalf("failed to clear memory")
+	}
+	if err := storage.Set(1, "counter", []byte("0")); err != nil {
+		t.Fatalf("mutate storage: %v", err)
+	}
+
+	dstMod, err := r.InstantiateModule(ctx, compiled, wazero.NewModuleConfig().WithName("snapshot-dst"))
+	if err != nil {
+		t.Fatalf("InstantiateModule (dst): %v", err)
+	}
+	dstStorage := luastore.NewMemoryStorage()
+
+	if err := RestoreVM(ctx, dstMod, dstStorage, snap); err != nil {
+		t.Fatalf("RestoreVM: %v", err)
+	}
+
+	got, ok := dstMod.Memory().Read(0, uint32(len(want)))
+	if !ok || string(got) != string(want) {
+		t.Fatalf("restored memory = %q, ok=%v; want %q", got, ok, want)
+	}
+
+	value, ok, err := dstStorage.Get(1, "counter")
+	if err != nil || !ok || string(value) != "41" {
+		t.Fatalf("restored storage[1][counter] = %q, ok=%v, err=%v; want %q", value, ok, err, "41")
+	}
+}
+
+func TestWireRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	writeUint32(&buf, 42)
+	writeUint64(&buf, 1<<40)
+	writeLenPrefixed(&buf, []byte("hello"))
+
+	r := bytes.NewReader(buf.Bytes())
+
+	gotUint32, err := readUint32(r)
+	if err != nil {
+		t.Fatalf("readUint32: %v", err)
+	}
+	if gotUint32 != 42 {
+		t.Fatalf("readUint32 = %d, want 42", gotUint32)
+	}
+
+	gotUint64, err := readUint64(r)
+	if err != nil {
+		t.Fatalf("readUint64: %v", err)
+	}
+	if gotUint64 != 1<<40 {
+		t.Fatalf("readUint64 = %d, want %d", gotUint64, uint64(1)<<40)
+	}
+
+	gotBytes, err := readLenPrefixed(r)
+	if err != nil {
+		t.Fatalf("readLenPrefixed: %v", err)
+	}
+	if string(gotBytes) != "hello" {
+		t.Fatalf("readLenPrefixed = %q, want %q", gotBytes, "hello")
+	}
+}
+
+func TestRestoreVMRejectsBadMagic(t *testing.T) {
+	err := RestoreVM(nil, nil, nil, []byte("not a snapshot"))
+	if err == nil {
+		t.Fatal("expected error for bad magic, got nil")
+	}
+}
+
+func TestRestoreVMRejectsTruncatedHeader(t *testing.T) {
+	err := RestoreVM(nil, nil, nil, magic[:2])
+	if err == nil {
+		t.Fatal("expected error for truncated header, got nil")
+	}
+}
+
+// TestRestoreVMRejectsDecompressionBombExceedingPageCount proves the
+// decompressed-memory path is bounded like every other untrusted field in
+// this format: a blob claiming pageCount pages but whose zstd stream
+// actually expands to far more than pageCount*wasmPageSize bytes (a small,
+// highly compressible payload standing in for a decompression bomb) must
+// be rejected rather than read in full via an unbounded io.ReadAll.
+func TestRestoreVMRejectsDecompressionBombExceedingPageCount(t *testing.T) {
+	const claimedPageCount = 1 // claims only wasmPageSize (64KiB) of memory
+
+	// Actual decompressed payload is far larger than the claim, the same
+	// shape a zip-bomb-style blob would have: tiny compressed, huge
+	// decompressed.
+	actual := bytes.Repeat([]byte{0}, 16*wasmPageSize)
+	var compressed bytes.Buffer
+	zw, err := zstd.NewWriter(&compressed)
+	if err != nil {
+		t.Fatalf("zstd.NewWriter: %v", err)
+	}
+	if _, err := zw.Write(actual); err != nil {
+		t.Fatalf("zw.Write: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("zw.Close: %v", err)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(magic[:])
+	buf.WriteByte(version)
+	writeUint32(&buf, claimedPageCount)
+	writeUint64(&buf, uint64(compressed.Len()))
+	buf.Write(compressed.Bytes())
+	writeUint32(&buf, 0) // tableCount
+
+	err = RestoreVM(context.Background(), nil, nil, buf.Bytes())
+	if err == nil {
+		t.Fatal("expected error for decompressed memory exceeding the claimed page count, got nil")
+	}
+}
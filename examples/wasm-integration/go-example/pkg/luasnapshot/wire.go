@@ -0,0 +1,72 @@
+package luasnapshot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// maxLenPrefixed bounds any single length-prefixed field read from an
+// untrusted snapshot blob, so a corrupted or adversarial length can't force
+// a multi-gigabyte allocation before the read itself is attempted to fail.
+const maxLenPrefixed = 256 << 20 // 256MiB
+
+// wasmPageSize is the fixed WASM linear memory page size in bytes.
+const wasmPageSize = 65536
+
+func writeUint32(buf *bytes.Buffer, v uint32) {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	buf.Write(b[:])
+}
+
+func writeUint64(buf *bytes.Buffer, v uint64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	buf.Write(b[:])
+}
+
+func writeLenPrefixed(buf *bytes.Buffer, data []byte) {
+	writeUint32(buf, uint32(len(data)))
+	buf.Write(data)
+}
+
+func readUint32(r *bytes.Reader) (uint32, error) {
+	var b [4]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(b[:]), nil
+}
+
+func readUint64(r *bytes.Reader) (uint64, error) {
+	var b [8]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(b[:]), nil
+}
+
+// readLenPrefixed reads a 4-byte length prefix followed by that many bytes.
+// The length is validated against both maxLenPrefixed and r's remaining
+// bytes before being used as an allocation size, so a corrupted or
+// adversarial blob can't force an oversized allocation ahead of the read
+// itself failing.
+func readLenPrefixed(r *bytes.Reader) ([]byte, error) {
+	length, err := readUint32(r)
+	if err != nil {
+		return nil, err
+	}
+	if length > maxLenPrefixed {
+		return nil, fmt.Errorf("length %d exceeds max of %d bytes", length, maxLenPrefixed)
+	}
+	if int64(length) > int64(r.Len()) {
+		return nil, fmt.Errorf("length %d exceeds %d remaining bytes", length, r.Len())
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("read %d-byte payload: %w", length, err)
+	}
+	return data, nil
+}
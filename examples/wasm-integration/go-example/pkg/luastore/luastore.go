@@ -0,0 +1,193 @@
+// Package luastore holds the pluggable Storage backend for external table
+// persistence, shared by the example binary, pkg/luapool, and pkg/luaserver
+// so a given tableID means the same thing no matter which Lua instance
+// handles a request.
+package luastore
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"go.etcd.io/bbolt"
+)
+
+// Storage is a pluggable backend for external table persistence. Tables are
+// namespaced by tableID so unrelated Lua VMs (or tenants) never see each
+// other's keys.
+type Storage interface {
+	Set(tableID uint32, key string, value []byte) error
+	Get(tableID uint32, key string) ([]byte, bool, error)
+	Delete(tableID uint32, key string) error
+	Size(tableID uint32) (int, error)
+	Keys(tableID uint32) ([]string, error)
+	Close() error
+}
+
+// MemoryStorage is the original in-memory backend: a map of tables that
+// vanishes at process exit. It's the default when no durable backend is
+// configured. Safe for concurrent use, since pool-backed callers share one
+// MemoryStorage across slots.
+type MemoryStorage struct {
+	mu     sync.Mutex
+	tables map[uint32]map[string][]byte
+}
+
+// NewMemoryStorage creates an empty in-memory storage backend.
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{tables: make(map[uint32]map[string][]byte)}
+}
+
+func (m *MemoryStorage) table(tableID uint32) map[string][]byte {
+	table, ok := m.tables[tableID]
+	if !ok {
+		table = make(map[string][]byte)
+		m.tables[tableID] = table
+	}
+	return table
+}
+
+func (m *MemoryStorage) Set(tableID uint32, key string, value []byte) error {
+	valueCopy := make([]byte, len(value))
+	copy(valueCopy, value)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.table(tableID)[key] = valueCopy
+	return nil
+}
+
+func (m *MemoryStorage) Get(tableID uint32, key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	value, ok := m.tables[tableID][key]
+	return value, ok, nil
+}
+
+func (m *MemoryStorage) Delete(tableID uint32, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.tables[tableID], key)
+	return nil
+}
+
+func (m *MemoryStorage) Size(tableID uint32) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.tables[tableID]), nil
+}
+
+func (m *MemoryStorage) Keys(tableID uint32) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	table := m.tables[tableID]
+	keys := make([]string, 0, len(table))
+	for key := range table {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (m *MemoryStorage) Close() error {
+	return nil
+}
+
+// BoltStorage persists external tables in a BoltDB (bbolt) file, one bucket
+// per tableID, so _home.counter and friends survive process restarts.
+type BoltStorage struct {
+	db *bbolt.DB
+}
+
+// NewBoltStorage opens (creating if necessary) a BoltDB file at path.
+func NewBoltStorage(path string) (*BoltStorage, error) {
+	db, err := bbolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, fmt.Errorf("open bolt storage: %w", err)
+	}
+	return &BoltStorage{db: db}, nil
+}
+
+func bucketName(tableID uint32) []byte {
+	name := make([]byte, 4)
+	binary.LittleEndian.PutUint32(name, tableID)
+	return name
+}
+
+func (b *BoltStorage) Set(tableID uint32, key string, value []byte) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(bucketName(tableID))
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(key), value)
+	})
+}
+
+func (b *BoltStorage) Get(tableID uint32, key string) ([]byte, bool, error) {
+	var value []byte
+	var found bool
+	err := b.db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(bucketName(tableID))
+		if bucket == nil {
+			return nil
+		}
+		if v := bucket.Get([]byte(key)); v != nil {
+			found = true
+			value = append([]byte(nil), v...)
+		}
+		return nil
+	})
+	return value, found, err
+}
+
+func (b *BoltStorage) Delete(tableID uint32, key string) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(bucketName(tableID))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.Delete([]byte(key))
+	})
+}
+
+func (b *BoltStorage) Size(tableID uint32) (int, error) {
+	count := 0
+	err := b.db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(bucketName(tableID))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(_, _ []byte) error {
+			count++
+			return nil
+		})
+	})
+	return count, err
+}
+
+func (b *BoltStorage) Keys(tableID uint32) ([]string, error) {
+	var keys []string
+	err := b.db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(bucketName(tableID))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, _ []byte) error {
+			keys = append(keys, string(k))
+			return nil
+		})
+	})
+	return keys, err
+}
+
+// Sync flushes pending writes to disk. ExternalTables.Sync calls this after
+// every compute invocation so a Lua invocation's writes land atomically.
+func (b *BoltStorage) Sync() error {
+	return b.db.Sync()
+}
+
+// Close releases the underlying BoltDB file handle. Safe to call once the
+// final Sync has completed.
+func (b *BoltStorage) Close() error {
+	return b.db.Close()
+}
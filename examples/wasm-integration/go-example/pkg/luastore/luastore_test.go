@@ -0,0 +1,114 @@
+package luastore
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// exerciseStorage runs the same Set/Get/Delete/Size/Keys round trip against
+// any Storage implementation, so MemoryStorage and BoltStorage are held to
+// the same contract.
+func exerciseStorage(t *testing.T, s Storage) {
+	t.Helper()
+
+	if _, ok, err := s.Get(1, "missing"); err != nil || ok {
+		t.Fatalf("Get(missing) = ok=%v, err=%v; want ok=false, err=nil", ok, err)
+	}
+
+	if err := s.Set(1, "counter", []byte("41")); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := s.Set(1, "name", []byte("ao")); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := s.Set(1, "blank", []byte{}); err != nil {
+		t.Fatalf("Set (empty value): %v", err)
+	}
+	if err := s.Set(2, "counter", []byte("0")); err != nil {
+		t.Fatalf("Set (other table): %v", err)
+	}
+
+	value, ok, err := s.Get(1, "counter")
+	if err != nil || !ok || string(value) != "41" {
+		t.Fatalf("Get(1, counter) = %q, ok=%v, err=%v; want %q", value, ok, err, "41")
+	}
+
+	// An explicitly empty value must still read back as present: it's a
+	// real key, not a tombstone.
+	if value, ok, err := s.Get(1, "blank"); err != nil || !ok || len(value) != 0 {
+		t.Fatalf("Get(1, blank) = %q, ok=%v, err=%v; want \"\", ok=true", value, ok, err)
+	}
+
+	size, err := s.Size(1)
+	if err != nil || size != 3 {
+		t.Fatalf("Size(1) = %d, err=%v; want 3", size, err)
+	}
+
+	keys, err := s.Keys(1)
+	if err != nil {
+		t.Fatalf("Keys(1): %v", err)
+	}
+	if len(keys) != 3 {
+		t.Fatalf("Keys(1) = %v, want 3 entries", keys)
+	}
+
+	if err := s.Delete(1, "counter"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, ok, err := s.Get(1, "counter"); err != nil || ok {
+		t.Fatalf("Get after Delete = ok=%v, err=%v; want ok=false, err=nil", ok, err)
+	}
+
+	// table 2 is untouched by anything done to table 1.
+	value, ok, err = s.Get(2, "counter")
+	if err != nil || !ok || string(value) != "0" {
+		t.Fatalf("Get(2, counter) = %q, ok=%v, err=%v; want %q (table isolation broken)", value, ok, err, "0")
+	}
+}
+
+func TestMemoryStorageRoundTrip(t *testing.T) {
+	exerciseStorage(t, NewMemoryStorage())
+}
+
+func TestBoltStorageRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.bolt")
+	db, err := NewBoltStorage(path)
+	if err != nil {
+		t.Fatalf("NewBoltStorage: %v", err)
+	}
+	defer db.Close()
+
+	exerciseStorage(t, db)
+}
+
+// TestBoltStorageSurvivesReopen is the entire point of a durable backend:
+// a value written before close must still be there after reopening the
+// same file, with no process alive in between.
+func TestBoltStorageSurvivesReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.bolt")
+
+	db, err := NewBoltStorage(path)
+	if err != nil {
+		t.Fatalf("NewBoltStorage: %v", err)
+	}
+	if err := db.Set(1, "counter", []byte("41")); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := db.Sync(); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	reopened, err := NewBoltStorage(path)
+	if err != nil {
+		t.Fatalf("NewBoltStorage (reopen): %v", err)
+	}
+	defer reopened.Close()
+
+	value, ok, err := reopened.Get(1, "counter")
+	if err != nil || !ok || string(value) != "41" {
+		t.Fatalf("Get after reopen = %q, ok=%v, err=%v; want %q", value, ok, err, "41")
+	}
+}
@@ -0,0 +1,158 @@
+package luaval
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Decode reads one tag-length-value encoded Value from the front of buf and
+// returns it. Nested tables recurse up to MaxDepth.
+func Decode(buf []byte) (Value, error) {
+	v, _, err := decode(buf, 0)
+	return v, err
+}
+
+func decode(buf []byte, depth int) (Value, int, error) {
+	if depth > MaxDepth {
+		return Value{}, 0, fmt.Errorf("luaval: table nesting exceeds max depth %d", MaxDepth)
+	}
+	if len(buf) < 1 {
+		return Value{}, 0, fmt.Errorf("luaval: empty buffer")
+	}
+
+	tag := buf[0]
+	rest := buf[1:]
+
+	switch tag {
+	case tagNil:
+		return Nil, 1, nil
+
+	case tagBool:
+		if len(rest) < 1 {
+			return Value{}, 0, fmt.Errorf("luaval: truncated bool")
+		}
+		return Value{Kind: KindBool, Bool: rest[0] != 0}, 2, nil
+
+	case tagNumber:
+		if len(rest) < 8 {
+			return Value{}, 0, fmt.Errorf("luaval: truncated number")
+		}
+		bits := binary.LittleEndian.Uint64(rest[:8])
+		return Value{Kind: KindNumber, Number: math.Float64frombits(bits)}, 9, nil
+
+	case tagString:
+		s, n, err := decodeLenPrefixed(rest)
+		if err != nil {
+			return Value{}, 0, err
+		}
+		return Value{Kind: KindString, Str: string(s)}, 1 + n, nil
+
+	case tagBytes:
+		b, n, err := decodeLenPrefixed(rest)
+		if err != nil {
+			return Value{}, 0, err
+		}
+		return Value{Kind: KindBytes, Bytes: append([]byte(nil), b...)}, 1 + n, nil
+
+	case tagTable:
+		if len(rest) < 4 {
+			return Value{}, 0, fmt.Errorf("luaval: truncated table count")
+		}
+		count := binary.LittleEndian.Uint32(rest[:4])
+		offset := 4
+
+		// Each entry needs at least 2 bytes (a 1-byte tag for both key and
+		// value, e.g. two tagNil entries). Bound count against what's
+		// actually left in the buffer before allocating, so a corrupted or
+		// adversarial count can't force a huge map allocation ahead of the
+		// per-entry bounds checks below.
+		if remaining := uint32(len(rest) - offset); count > remaining/2 {
+			return Value{}, 0, fmt.Errorf("luaval: table count %d implausible for %d remaining bytes", count, remaining)
+		}
+		table := make(map[string]Value, count)
+		for i := uint32(0); i < count; i++ {
+			key, keyN, err := decode(rest[offset:], depth+1)
+			if err != nil {
+				return Value{}, 0, fmt.Errorf("luaval: table key %d: %w", i, err)
+			}
+			if key.Kind != KindString {
+				return Value{}, 0, fmt.Errorf("luaval: table key %d has non-string kind %s", i, key.Kind)
+			}
+			offset += keyN
+
+			val, valN, err := decode(rest[offset:], depth+1)
+			if err != nil {
+				return Value{}, 0, fmt.Errorf("luaval: table value %d: %w", i, err)
+			}
+			offset += valN
+
+			table[key.Str] = val
+		}
+		return Value{Kind: KindTable, Table: table}, 1 + offset, nil
+
+	default:
+		return Value{}, 0, fmt.Errorf("luaval: unknown tag 0x%02x", tag)
+	}
+}
+
+func decodeLenPrefixed(buf []byte) ([]byte, int, error) {
+	if len(buf) < 4 {
+		return nil, 0, fmt.Errorf("luaval: truncated length prefix")
+	}
+	length := binary.LittleEndian.Uint32(buf[:4])
+	if uint32(len(buf)) < 4+length {
+		return nil, 0, fmt.Errorf("luaval: truncated payload, want %d bytes", length)
+	}
+	return buf[4 : 4+length], 4 + int(length), nil
+}
+
+// Encode writes v in the same tag-length-value format Decode reads, for use
+// once compute grows a way to accept arguments.
+func Encode(v Value) []byte {
+	switch v.Kind {
+	case KindNil:
+		return []byte{tagNil}
+
+	case KindBool:
+		b := byte(0)
+		if v.Bool {
+			b = 1
+		}
+		return []byte{tagBool, b}
+
+	case KindNumber:
+		buf := make([]byte, 9)
+		buf[0] = tagNumber
+		binary.LittleEndian.PutUint64(buf[1:], math.Float64bits(v.Number))
+		return buf
+
+	case KindString:
+		return encodeLenPrefixed(tagString, []byte(v.Str))
+
+	case KindBytes:
+		return encodeLenPrefixed(tagBytes, v.Bytes)
+
+	case KindTable:
+		buf := []byte{tagTable}
+		count := make([]byte, 4)
+		binary.LittleEndian.PutUint32(count, uint32(len(v.Table)))
+		buf = append(buf, count...)
+		for key, val := range v.Table {
+			buf = append(buf, Encode(Value{Kind: KindString, Str: key})...)
+			buf = append(buf, Encode(val)...)
+		}
+		return buf
+
+	default:
+		return []byte{tagNil}
+	}
+}
+
+func encodeLenPrefixed(tag byte, payload []byte) []byte {
+	buf := make([]byte, 1+4+len(payload))
+	buf[0] = tag
+	binary.LittleEndian.PutUint32(buf[1:5], uint32(len(payload)))
+	copy(buf[5:], payload)
+	return buf
+}
@@ -0,0 +1,96 @@
+package luaval
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func roundTrip(t *testing.T, v Value) Value {
+	t.Helper()
+	got, err := Decode(Encode(v))
+	if err != nil {
+		t.Fatalf("Decode(Encode(%v)): %v", v, err)
+	}
+	return got
+}
+
+func TestRoundTripScalars(t *testing.T) {
+	cases := []Value{
+		Nil,
+		{Kind: KindBool, Bool: true},
+		{Kind: KindBool, Bool: false},
+		{Kind: KindNumber, Number: 3.5},
+		{Kind: KindString, Str: "hello"},
+		{Kind: KindBytes, Bytes: []byte{1, 2, 3}},
+	}
+	for _, v := range cases {
+		got := roundTrip(t, v)
+		if !reflect.DeepEqual(got, v) {
+			t.Errorf("round trip = %+v, want %+v", got, v)
+		}
+	}
+}
+
+func TestRoundTripTable(t *testing.T) {
+	v := Value{Kind: KindTable, Table: map[string]Value{
+		"count": {Kind: KindNumber, Number: 1},
+		"nested": {Kind: KindTable, Table: map[string]Value{
+			"ok": {Kind: KindBool, Bool: true},
+		}},
+	}}
+	got := roundTrip(t, v)
+	if !reflect.DeepEqual(got, v) {
+		t.Errorf("round trip = %+v, want %+v", got, v)
+	}
+}
+
+func TestDecodeRejectsExcessiveNesting(t *testing.T) {
+	// Build a table nested deeper than MaxDepth.
+	v := Value{Kind: KindBool, Bool: true}
+	for i := 0; i < MaxDepth+2; i++ {
+		v = Value{Kind: KindTable, Table: map[string]Value{"k": v}}
+	}
+	if _, err := Decode(Encode(v)); err == nil {
+		t.Fatal("expected error decoding table nested beyond MaxDepth, got nil")
+	}
+}
+
+func TestDecodeTruncatedBuffer(t *testing.T) {
+	if _, err := Decode([]byte{tagNumber, 0x01}); err == nil {
+		t.Fatal("expected error decoding truncated number, got nil")
+	}
+}
+
+func TestMarshalJSONEncodesKindNotFields(t *testing.T) {
+	cases := []struct {
+		v    Value
+		want string
+	}{
+		{Nil, "null"},
+		{Value{Kind: KindBool, Bool: true}, "true"},
+		{Value{Kind: KindNumber, Number: 3.5}, "3.5"},
+		{Value{Kind: KindString, Str: "hi"}, `"hi"`},
+		{Value{Kind: KindTable, Table: map[string]Value{
+			"count": {Kind: KindNumber, Number: 1},
+		}}, `{"count":1}`},
+	}
+	for _, tc := range cases {
+		got, err := json.Marshal(tc.v)
+		if err != nil {
+			t.Fatalf("json.Marshal(%+v): %v", tc.v, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("json.Marshal(%+v) = %s, want %s", tc.v, got, tc.want)
+		}
+	}
+}
+
+func TestDecodeRejectsImplausibleTableCount(t *testing.T) {
+	// tagTable with a count of ~4 billion but no entries to back it, as an
+	// adversarial payload might send to force a huge map allocation.
+	buf := []byte{tagTable, 0xff, 0xff, 0xff, 0xff}
+	if _, err := Decode(buf); err == nil {
+		t.Fatal("expected error decoding table with implausible count, got nil")
+	}
+}
@@ -0,0 +1,122 @@
+// Package luaval decodes and encodes the tag-length-value stream lua.wasm
+// uses to move Lua values across the WASM boundary, as a typed Value sum
+// type instead of ad-hoc byte-slicing at each call site. Only the number
+// and string tags are confirmed against lua.wasm's actual output; see the
+// wire tag constants below for which ones are still provisional.
+package luaval
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Kind identifies which alternative of Value is populated.
+type Kind byte
+
+const (
+	KindNil Kind = iota
+	KindBool
+	KindNumber
+	KindString
+	KindTable
+	KindBytes
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindNil:
+		return "nil"
+	case KindBool:
+		return "bool"
+	case KindNumber:
+		return "number"
+	case KindString:
+		return "string"
+	case KindTable:
+		return "table"
+	case KindBytes:
+		return "bytes"
+	default:
+		return "unknown"
+	}
+}
+
+// Value is a decoded Lua value. Only the field matching Kind is meaningful.
+type Value struct {
+	Kind   Kind
+	Bool   bool
+	Number float64
+	Str    string
+	Table  map[string]Value
+	Bytes  []byte
+}
+
+// Nil is the decoded nil value.
+var Nil = Value{Kind: KindNil}
+
+// Wire tags for the tag-length-value stream lua.wasm writes into the
+// shared buffer. Only tagNumber (0x03) and tagString (0x04) are confirmed
+// against lua.wasm's actual output (see main.go's original result
+// parsing); tagNil, tagBool, tagTable, and tagBytes are this package's own
+// provisional assignments, not yet verified against the real binary or its
+// source. If lua.wasm turns out to encode any of those four differently,
+// Decode will silently produce a wrong Kind for real nil/bool/table/bytes
+// results rather than erroring — only a genuinely unknown tag byte hits the
+// default case in decode(). Confirm these four against lua.wasm (or its
+// source) before relying on them for anything beyond this package's own
+// Encode/Decode round trip.
+const (
+	tagNil    byte = 0x01
+	tagBool   byte = 0x02
+	tagNumber byte = 0x03
+	tagString byte = 0x04
+	tagTable  byte = 0x05
+	tagBytes  byte = 0x06
+)
+
+// MaxDepth bounds table recursion during Decode so an adversarial payload
+// can't blow the Go stack with deeply nested tables.
+const MaxDepth = 32
+
+// MarshalJSON encodes v as the JSON value it actually represents (null,
+// bool, number, string, a base64 string for bytes, or an object for a
+// table), instead of the exported-fields-regardless-of-Kind encoding the
+// default struct marshaler would produce. Table entries are marshaled
+// recursively through this same method.
+func (v Value) MarshalJSON() ([]byte, error) {
+	switch v.Kind {
+	case KindNil:
+		return []byte("null"), nil
+	case KindBool:
+		return json.Marshal(v.Bool)
+	case KindNumber:
+		return json.Marshal(v.Number)
+	case KindString:
+		return json.Marshal(v.Str)
+	case KindBytes:
+		return json.Marshal(v.Bytes)
+	case KindTable:
+		return json.Marshal(v.Table)
+	default:
+		return []byte("null"), nil
+	}
+}
+
+func (v Value) String() string {
+	switch v.Kind {
+	case KindNil:
+		return "nil"
+	case KindBool:
+		return fmt.Sprintf("%v", v.Bool)
+	case KindNumber:
+		return fmt.Sprintf("%v", v.Number)
+	case KindString:
+		return v.Str
+	case KindBytes:
+		return fmt.Sprintf("<%d bytes>", len(v.Bytes))
+	case KindTable:
+		return fmt.Sprintf("<table, %d entries>", len(v.Table))
+	default:
+		return "<invalid>"
+	}
+}
@@ -0,0 +1,40 @@
+package luaval
+
+import "github.com/vmihailenco/msgpack/v5"
+
+// EncodeMsgpack implements msgpack.CustomEncoder so a Value can be handed to
+// Go callers or JSON/msgpack pipelines without a lossy fmt.Sprintf.
+func (v Value) EncodeMsgpack(enc *msgpack.Encoder) error {
+	switch v.Kind {
+	case KindNil:
+		return enc.EncodeNil()
+	case KindBool:
+		return enc.EncodeBool(v.Bool)
+	case KindNumber:
+		return enc.EncodeFloat64(v.Number)
+	case KindString:
+		return enc.EncodeString(v.Str)
+	case KindBytes:
+		return enc.EncodeBytes(v.Bytes)
+	case KindTable:
+		if err := enc.EncodeMapLen(len(v.Table)); err != nil {
+			return err
+		}
+		for key, val := range v.Table {
+			if err := enc.EncodeString(key); err != nil {
+				return err
+			}
+			if err := val.EncodeMsgpack(enc); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return enc.EncodeNil()
+	}
+}
+
+// Marshal is a convenience wrapper around msgpack.Marshal for a Value.
+func Marshal(v Value) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"os"
+
+	"github.com/twilson63/cu/examples/wasm-integration/go-example/pkg/luastore"
+)
+
+// newStorageFromEnv picks a Storage backend for the example: BoltStorage at
+// CU_BOLT_PATH when set, otherwise the original in-memory behavior.
+func newStorageFromEnv() (luastore.Storage, error) {
+	if path := os.Getenv("CU_BOLT_PATH"); path != "" {
+		return luastore.NewBoltStorage(path)
+	}
+	return luastore.NewMemoryStorage(), nil
+}